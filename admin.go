@@ -1,28 +1,20 @@
 package main
 
-import "github.com/jakubbortlik/chirpy/internal/database"
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
-	"os"
 )
 
 func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
-	if platform := os.Getenv("PLATFORM"); platform != "dev" {
-		respondWithError(w, http.StatusForbidden, "Resetting only allowed in local dev environment.", nil)
+	if cfg.platform != "dev" {
+		respondWithError(w, r, errForbidden, "Resetting is only allowed in the local dev environment", nil)
 		return
 	}
 	cfg.fileserverHits.Store(0)
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
-	if err == nil {
-		dbQueries := database.New(db)
-		err = dbQueries.DeleteUsers(r.Context())
-	}
+	err := cfg.db.DeleteUsers(r.Context())
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Deleting users failed.", err)
+		respondWithError(w, r, errInternal, "Deleting users failed", err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -43,3 +35,20 @@ func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
 	)
 	w.Write([]byte(html))
 }
+
+// handlerUnlockUser clears the failed-login throttle of a user so that a
+// locked-out account can log in again before its lockout expires.
+func (cfg *apiConfig) handlerUnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.pathUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeleteLoginThrottle(r.Context(), accountThrottleKey(user.Email))
+	if err != nil {
+		respondWithError(w, r, errInternal, "Unlocking user failed", err)
+		return
+	}
+	cfg.recordLoginEvent(r, user.Email, user.ID, loginEventUnlocked)
+	respondWithNoBody(w, http.StatusNoContent)
+}
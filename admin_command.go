@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jakubbortlik/chirpy/internal/config"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/store"
+)
+
+// runAdmin implements `chirpy admin promote|demote <email> [flags]`, which
+// grants or revokes the admin role. It is how the first admin is created.
+func runAdmin(args []string) {
+	const usage = "chirpy admin promote|demote <email> [flags]"
+	if len(args) < 2 || args[0] != "promote" && args[0] != "demote" {
+		loadConfig([]string{"-h"}, usage)
+	}
+	command, email := args[0], args[1]
+	conf := loadConfig(args[2:], usage)
+	if conf.Store != "postgres" {
+		fatal("Managing admins needs STORE=postgres", "store", conf.Store)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	user, err := setAdmin(ctx, conf, email, command == "promote")
+	if errors.Is(err, sql.ErrNoRows) {
+		fatal("User not found", "email", email)
+	}
+	if err != nil {
+		fatal("Updating admin role failed", "email", email, "error", err)
+	}
+	slog.Info("Updated admin role", "email", user.Email, "user_id", user.ID, "is_admin", user.IsAdmin)
+}
+
+// setAdmin grants or revokes the admin role of the user with the email. It
+// returns instead of exiting so that the database is always closed.
+func setAdmin(ctx context.Context, conf config.Config, email string, isAdmin bool) (database.User, error) {
+	dbPool, err := openDB(ctx, conf)
+	if err != nil {
+		return database.User{}, fmt.Errorf("connecting to database: %w", err)
+	}
+	db := store.NewPostgres(dbPool, nil)
+	defer db.Close()
+
+	return db.SetUserAdmin(ctx, database.SetUserAdminParams{
+		Email:   email,
+		IsAdmin: isAdmin,
+	})
+}
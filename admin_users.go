@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 500
+)
+
+// AdminUser is the view of a user in the admin API.
+type AdminUser struct {
+	User
+	IsAdmin bool `json:"is_admin"`
+}
+
+func newAdminUser(user database.User) AdminUser {
+	return AdminUser{
+		User:    newUser(user),
+		IsAdmin: user.IsAdmin,
+	}
+}
+
+// pathUser looks up the user named by the {userID} path wildcard. On failure
+// it responds with an error and returns false.
+func (cfg *apiConfig) pathUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, errInvalidID, "Invalid user ID", err)
+		return database.User{}, false
+	}
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, r, storeProblem(err, errUserNotFound), "", err)
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// handlerAdminListUsers lists users, optionally only those whose email
+// contains the q query parameter, paginated with limit and offset.
+func (cfg *apiConfig) handlerAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	var v validate.Validator
+	limit := queryInt(&v, r, "limit", defaultAdminPageSize, 1, maxAdminPageSize)
+	offset := queryInt(&v, r, "offset", 0, 0, 1<<31-1)
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	users, err := cfg.db.ListUsers(r.Context(), database.ListUsersParams{
+		Query:  r.URL.Query().Get("q"),
+		Limit:  int32(limit),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		respondWithError(w, r, errInternal, "Listing users failed", err)
+		return
+	}
+	resp := make([]AdminUser, 0, len(users))
+	for _, user := range users {
+		resp = append(resp, newAdminUser(user))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.pathUser(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newAdminUser(user))
+}
+
+// handlerAdminGetUserChirps lists the chirps of a user oldest first, a page
+// at a time like handlerGetChirps.
+func (cfg *apiConfig) handlerAdminGetUserChirps(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.pathUser(w, r)
+	if !ok {
+		return
+	}
+	var v validate.Validator
+	limit := queryInt(&v, r, "limit", defaultChirpPageSize, 1, maxChirpPageSize)
+	params := database.ListChirpsParams{AuthorIds: []uuid.UUID{user.ID}, Limit: int32(limit) + 1}
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		cursor, err := parseChirpCursor(c)
+		v.Check(err == nil, "cursor", "must be a cursor from a previous response")
+		params.AfterCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: err == nil}
+		params.AfterID = uuid.NullUUID{UUID: cursor.ID, Valid: err == nil}
+	}
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	chirps, err := cfg.db.ListChirps(r.Context(), params)
+	if err != nil {
+		respondWithError(w, r, errInternal, "Getting chirps failed", err)
+		return
+	}
+	if len(chirps) > limit {
+		chirps = chirps[:limit]
+		last := chirps[limit-1]
+		setNextLink(w, r, chirpCursor{CreatedAt: last.CreatedAt, ID: last.ID}.String())
+	}
+	resp := make([]Chirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		resp = append(resp, newChirp(chirp))
+	}
+	if err := cfg.completeChirpsAll(r.Context(), resp); err != nil {
+		respondWithError(w, r, errInternal, "Getting chirps failed", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerAdminGetUserRefreshTokens lists the refresh tokens of a user. The
+// tokens themselves are secrets, so only a prefix is shown, enough to match
+// them against logs.
+func (cfg *apiConfig) handlerAdminGetUserRefreshTokens(w http.ResponseWriter, r *http.Request) {
+	type refreshToken struct {
+		TokenPrefix string     `json:"token_prefix"`
+		CreatedAt   time.Time  `json:"created_at"`
+		ExpiresAt   time.Time  `json:"expires_at"`
+		RevokedAt   *time.Time `json:"revoked_at"`
+	}
+
+	user, ok := cfg.pathUser(w, r)
+	if !ok {
+		return
+	}
+	tokens, err := cfg.db.GetRefreshTokensForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, r, errInternal, "Getting refresh tokens failed", err)
+		return
+	}
+	resp := make([]refreshToken, 0, len(tokens))
+	for _, token := range tokens {
+		t := refreshToken{
+			TokenPrefix: token.Token[:min(8, len(token.Token))],
+			CreatedAt:   token.CreatedAt,
+			ExpiresAt:   token.ExpiresAt,
+		}
+		if token.RevokedAt.Valid {
+			t.RevokedAt = &token.RevokedAt.Time
+		}
+		resp = append(resp, t)
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerAdminSetChirpyRed grants or revokes Chirpy Red by hand, e.g. when a
+// payment webhook was missed.
+func (cfg *apiConfig) handlerAdminSetChirpyRed(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		IsChirpyRed *bool `json:"is_chirpy_red"`
+	}
+
+	user, ok := cfg.pathUser(w, r)
+	if !ok {
+		return
+	}
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+	var v validate.Validator
+	v.Check(params.IsChirpyRed != nil, "is_chirpy_red", "is required")
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	user, err := cfg.db.SetChirpyRed(r.Context(), database.SetChirpyRedParams{
+		ID:          user.ID,
+		IsChirpyRed: *params.IsChirpyRed,
+	})
+	if err != nil {
+		respondWithError(w, r, storeProblem(err, errUserNotFound), "", err)
+		return
+	}
+	requestLogger(r.Context()).Info("Set Chirpy Red", "target_user_id", user.ID, "is_chirpy_red", user.IsChirpyRed)
+	respondWithJSON(w, http.StatusOK, newAdminUser(user))
+}
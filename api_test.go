@@ -0,0 +1,2887 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/auth"
+	"github.com/jakubbortlik/chirpy/internal/config"
+	"github.com/jakubbortlik/chirpy/internal/cors"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/ratelimit"
+	"github.com/jakubbortlik/chirpy/internal/store"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+)
+
+const (
+	testJWTSecret = "testJWTSecret"
+	testPolkaKey  = "testPolkaKey"
+)
+
+// testAPI is the full mux from routes() backed by a fresh in-memory store.
+type testAPI struct {
+	t       *testing.T
+	cfg     *apiConfig
+	handler http.Handler
+}
+
+func newTestAPI(t *testing.T, platform string) *testAPI {
+	t.Helper()
+	conf := testConfig()
+	conf.Platform = platform
+	return newTestAPIWithConfig(t, conf)
+}
+
+func testConfig() config.Config {
+	return config.Config{
+		JWTSecret:       testJWTSecret,
+		PolkaKey:        testPolkaKey,
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: time.Hour,
+		MaxChirpLength:  140,
+
+		LoginFailureWindow:   time.Hour,
+		LoginDelayAfter:      3,
+		LoginDelay:           time.Second,
+		LoginMaxDelay:        time.Minute,
+		LoginLockoutAfter:    10,
+		LoginLockoutDuration: 15 * time.Minute,
+		LoginIPLockoutAfter:  100,
+	}
+}
+
+func newTestAPIWithConfig(t *testing.T, conf config.Config) *testAPI {
+	t.Helper()
+	cfg := newAPIConfig(conf, store.NewMemory(), ratelimit.NewMemory(), newMetrics())
+	t.Cleanup(cfg.stopWorkers)
+	handler, err := cfg.routes(".")
+	if err != nil {
+		t.Fatalf("routes() error = %v", err)
+	}
+	return &testAPI{t: t, cfg: cfg, handler: handler}
+}
+
+// request sends body, JSON encoded unless it is a string, with the given
+// Authorization header value.
+func (a *testAPI) request(method, path, authorization string, body any) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var reader *bytes.Reader
+	switch b := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case string:
+		reader = bytes.NewReader([]byte(b))
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (a *testAPI) createUser(email, password string) User {
+	a.t.Helper()
+	rec := a.request("POST", "/api/users", "", map[string]string{"email": email, "password": password})
+	requireStatus(a.t, rec, http.StatusCreated)
+	return decode[User](a.t, rec)
+}
+
+type loginResponse struct {
+	User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (a *testAPI) login(email, password string) loginResponse {
+	a.t.Helper()
+	rec := a.request("POST", "/api/login", "", map[string]string{"email": email, "password": password})
+	requireStatus(a.t, rec, http.StatusOK)
+	return decode[loginResponse](a.t, rec)
+}
+
+// createAdmin creates a user with the admin role and returns their access
+// token.
+func (a *testAPI) createAdmin(email, password string) string {
+	a.t.Helper()
+	a.createUser(email, password)
+	_, err := a.cfg.db.SetUserAdmin(context.Background(), database.SetUserAdminParams{Email: email, IsAdmin: true})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.login(email, password).Token
+}
+
+func (a *testAPI) postChirp(token, body string) Chirp {
+	a.t.Helper()
+	rec := a.request("POST", "/api/chirps", bearer(token), map[string]string{"body": body})
+	requireStatus(a.t, rec, http.StatusCreated)
+	return decode[Chirp](a.t, rec)
+}
+
+// collectPages follows next links from path and returns the chirp IDs of
+// every page, failing after maxPages pages.
+func (a *testAPI) collectPages(t *testing.T, path string, maxPages int) [][]uuid.UUID {
+	t.Helper()
+	var pages [][]uuid.UUID
+	for path != "" {
+		rec := a.request("GET", path, "", nil)
+		requireStatus(t, rec, http.StatusOK)
+		var ids []uuid.UUID
+		for _, chirp := range decode[[]Chirp](t, rec) {
+			ids = append(ids, chirp.Id)
+		}
+		pages = append(pages, ids)
+		path = ""
+		if link := rec.Header().Get("Link"); link != "" {
+			m := nextLinkRE.FindStringSubmatch(link)
+			if m == nil {
+				t.Fatalf("Link = %q", link)
+			}
+			path = m[1]
+		}
+		if len(pages) > maxPages {
+			t.Fatal("pagination does not terminate")
+		}
+	}
+	return pages
+}
+
+func bearer(token string) string {
+	return "Bearer " + token
+}
+
+func requireStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) problemDocument {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q, want %q", ct, "application/problem+json")
+	}
+	return decode[problemDocument](t, rec)
+}
+
+func problemCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	return decodeProblem(t, rec).Code
+}
+
+type apiTest struct {
+	name          string
+	method        string
+	path          string
+	authorization string
+	body          any
+	wantStatus    int
+	check         func(t *testing.T, rec *httptest.ResponseRecorder)
+}
+
+func runAPITests(t *testing.T, api *testAPI, tests []apiTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api.t = t
+			rec := api.request(tt.method, tt.path, tt.authorization, tt.body)
+			requireStatus(t, rec, tt.wantStatus)
+			if tt.check != nil {
+				tt.check(t, rec)
+			}
+		})
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	api := newTestAPI(t, "")
+	requireStatus(t, api.request("GET", "/api/healthz", "", nil), http.StatusOK)
+
+	api.cfg.draining.Store(true)
+	requireStatus(t, api.request("GET", "/api/healthz", "", nil), http.StatusServiceUnavailable)
+}
+
+func TestUsers(t *testing.T) {
+	api := newTestAPI(t, "")
+	walt := api.createUser("walt@example.com", "blue")
+	if walt.Email == nil || *walt.Email != "walt@example.com" || walt.IsChirpyRed || walt.Id == uuid.Nil {
+		t.Fatalf("createUser() = %+v", walt)
+	}
+	api.createUser("jesse@example.com", "yo")
+	waltLogin := api.login("walt@example.com", "blue")
+	wantEmailTaken := func(t *testing.T, rec *httptest.ResponseRecorder) {
+		if code := problemCode(t, rec); code != "email_taken" {
+			t.Errorf("code = %q", code)
+		}
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:       "Duplicate email",
+			method:     "POST",
+			path:       "/api/users",
+			body:       map[string]string{"email": "walt@example.com", "password": "other"},
+			wantStatus: http.StatusConflict,
+			check:      wantEmailTaken,
+		},
+		{
+			name:       "Update without token",
+			method:     "PUT",
+			path:       "/api/users",
+			body:       map[string]string{"email": "heisenberg@example.com", "password": "crystal"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Update with invalid token",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer("not-a-jwt"),
+			body:          map[string]string{"email": "heisenberg@example.com", "password": "crystal"},
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Update to taken email",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(waltLogin.Token),
+			body:          map[string]string{"email": "jesse@example.com", "password": "crystal"},
+			wantStatus:    http.StatusConflict,
+			check:         wantEmailTaken,
+		},
+		{
+			name:          "Update own account",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(waltLogin.Token),
+			body:          map[string]string{"email": "heisenberg@example.com", "password": "crystal"},
+			wantStatus:    http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				user := decode[User](t, rec)
+				if user.Id != walt.Id || *user.Email != "heisenberg@example.com" {
+					t.Errorf("updated user = %+v", user)
+				}
+			},
+		},
+		{
+			name:       "Login with new credentials",
+			method:     "POST",
+			path:       "/api/login",
+			body:       map[string]string{"email": "heisenberg@example.com", "password": "crystal"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Login with old password",
+			method:     "POST",
+			path:       "/api/login",
+			body:       map[string]string{"email": "heisenberg@example.com", "password": "blue"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Login with unknown email",
+			method:     "POST",
+			path:       "/api/login",
+			body:       map[string]string{"email": "gus@example.com", "password": "chicken"},
+			wantStatus: http.StatusUnauthorized,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if code := problemCode(t, rec); code != "invalid_credentials" {
+					t.Errorf("code = %q", code)
+				}
+			},
+		},
+	})
+}
+
+func TestLoginTokens(t *testing.T) {
+	api := newTestAPI(t, "")
+	user := api.createUser("saul@example.com", "goodman")
+	login := api.login("saul@example.com", "goodman")
+
+	if login.Id != user.Id || login.Token == "" || login.RefreshToken == "" {
+		t.Fatalf("login() = %+v", login)
+	}
+	if userID, err := auth.ValidateJWT(login.Token, testJWTSecret); err != nil || userID != user.Id {
+		t.Fatalf("ValidateJWT(login token) = %s, %v", userID, err)
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:       "Refresh without token",
+			method:     "POST",
+			path:       "/api/refresh",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Refresh with unknown token",
+			method:        "POST",
+			path:          "/api/refresh",
+			authorization: bearer("unknown"),
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Refresh",
+			method:        "POST",
+			path:          "/api/refresh",
+			authorization: bearer(login.RefreshToken),
+			wantStatus:    http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				token := decode[struct {
+					Token string `json:"token"`
+				}](t, rec).Token
+				if userID, err := auth.ValidateJWT(token, testJWTSecret); err != nil || userID != user.Id {
+					t.Errorf("ValidateJWT(refreshed token) = %s, %v", userID, err)
+				}
+			},
+		},
+		{
+			name:          "Revoke",
+			method:        "POST",
+			path:          "/api/revoke",
+			authorization: bearer(login.RefreshToken),
+			wantStatus:    http.StatusNoContent,
+		},
+		{
+			name:          "Refresh after revoke",
+			method:        "POST",
+			path:          "/api/refresh",
+			authorization: bearer(login.RefreshToken),
+			wantStatus:    http.StatusUnauthorized,
+		},
+	})
+}
+
+func TestChirps(t *testing.T) {
+	api := newTestAPI(t, "")
+	alice := api.createUser("alice@example.com", "wonderland")
+	bob := api.createUser("bob@example.com", "builder")
+	aliceToken := api.login("alice@example.com", "wonderland").Token
+	bobToken := api.login("bob@example.com", "builder").Token
+
+	first := api.postChirp(aliceToken, "Hello from Alice")
+	second := api.postChirp(bobToken, "Hello from Bob")
+	third := api.postChirp(aliceToken, "Alice again")
+
+	chirpIDs := func(t *testing.T, rec *httptest.ResponseRecorder) []uuid.UUID {
+		var ids []uuid.UUID
+		for _, chirp := range decode[[]Chirp](t, rec) {
+			ids = append(ids, chirp.Id)
+		}
+		return ids
+	}
+	wantIDs := func(want ...uuid.UUID) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			got := chirpIDs(t, rec)
+			if len(got) != len(want) {
+				t.Fatalf("got %d chirps, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("chirp[%d] = %s, want %s", i, got[i], want[i])
+				}
+			}
+		}
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:       "Post without token",
+			method:     "POST",
+			path:       "/api/chirps",
+			body:       map[string]string{"body": "anonymous"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Post with token signed by another secret",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(mustMakeJWT(t, alice.Id, "wrongSecret")),
+			body:          map[string]string{"body": "forged"},
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Post too long",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(aliceToken),
+			body:          map[string]string{"body": strings.Repeat("a", 141)},
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "Post cleans profanity",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(bobToken),
+			body:          map[string]string{"body": "What a Kerfuffle here sharbert!"},
+			wantStatus:    http.StatusCreated,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				chirp := decode[Chirp](t, rec)
+				if chirp.Body != "What a **** here sharbert!" || chirp.UserID != bob.Id {
+					t.Errorf("chirp = %+v", chirp)
+				}
+			},
+		},
+		{
+			name:       "Get one",
+			method:     "GET",
+			path:       "/api/chirps/" + second.Id.String(),
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				chirp := decode[Chirp](t, rec)
+				if chirp.Id != second.Id || chirp.Body != "Hello from Bob" || chirp.UserID != bob.Id {
+					t.Errorf("chirp = %+v", chirp)
+				}
+			},
+		},
+		{
+			name:       "Get unknown",
+			method:     "GET",
+			path:       "/api/chirps/" + uuid.NewString(),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Filter by author",
+			method:     "GET",
+			path:       "/api/chirps?author_id=" + alice.Id.String(),
+			wantStatus: http.StatusOK,
+			check:      wantIDs(first.Id, third.Id),
+		},
+		{
+			name:       "Filter by author without chirps",
+			method:     "GET",
+			path:       "/api/chirps?author_id=" + uuid.NewString(),
+			wantStatus: http.StatusOK,
+			check:      wantIDs(),
+		},
+		{
+			name:       "Delete without token",
+			method:     "DELETE",
+			path:       "/api/chirps/" + first.Id.String(),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Delete someone else's chirp",
+			method:        "DELETE",
+			path:          "/api/chirps/" + first.Id.String(),
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "Delete own chirp",
+			method:        "DELETE",
+			path:          "/api/chirps/" + first.Id.String(),
+			authorization: bearer(aliceToken),
+			wantStatus:    http.StatusNoContent,
+		},
+		{
+			name:          "Delete deleted chirp",
+			method:        "DELETE",
+			path:          "/api/chirps/" + first.Id.String(),
+			authorization: bearer(aliceToken),
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:       "List after delete",
+			method:     "GET",
+			path:       "/api/chirps?author_id=" + alice.Id.String(),
+			wantStatus: http.StatusOK,
+			check:      wantIDs(third.Id),
+		},
+	})
+}
+
+func TestChirpEditing(t *testing.T) {
+	api := newTestAPI(t, "")
+	api.createUser("alice@example.com", "wonderland")
+	api.createUser("bob@example.com", "builder")
+	aliceToken := api.login("alice@example.com", "wonderland").Token
+	bobToken := api.login("bob@example.com", "builder").Token
+
+	chirp := api.postChirp(aliceToken, "Helo world")
+	if chirp.Edited {
+		t.Fatalf("new chirp = %+v, want not edited", chirp)
+	}
+	path := "/api/chirps/" + chirp.Id.String()
+
+	wantRevisions := func(bodies ...string) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			type revision struct {
+				Body       string    `json:"body"`
+				CreatedAt  time.Time `json:"created_at"`
+				ReplacedAt time.Time `json:"replaced_at"`
+			}
+			revisions := decode[[]revision](t, rec)
+			var got []string
+			for _, rev := range revisions {
+				got = append(got, rev.Body)
+				if !rev.ReplacedAt.After(rev.CreatedAt) {
+					t.Errorf("revision %+v replaced before it was created", rev)
+				}
+			}
+			if !reflect.DeepEqual(got, bodies) {
+				t.Errorf("revisions = %q, want %q", got, bodies)
+			}
+		}
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:       "No revisions yet",
+			method:     "GET",
+			path:       path + "/revisions",
+			wantStatus: http.StatusOK,
+			check:      wantRevisions(),
+		},
+		{
+			name:       "Edit without token",
+			method:     "PUT",
+			path:       path,
+			body:       map[string]string{"body": "Hello world"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Edit someone else's chirp",
+			method:        "PUT",
+			path:          path,
+			authorization: bearer(bobToken),
+			body:          map[string]string{"body": "Hello from Bob"},
+			wantStatus:    http.StatusForbidden,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if code := problemCode(t, rec); code != errForbiddenNotOwner.code {
+					t.Errorf("code = %q, want %q", code, errForbiddenNotOwner.code)
+				}
+			},
+		},
+		{
+			name:          "Edit unknown chirp",
+			method:        "PUT",
+			path:          "/api/chirps/" + uuid.NewString(),
+			authorization: bearer(aliceToken),
+			body:          map[string]string{"body": "Hello world"},
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:          "Edit invalid ID",
+			method:        "PUT",
+			path:          "/api/chirps/nope",
+			authorization: bearer(aliceToken),
+			body:          map[string]string{"body": "Hello world"},
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "Edit too long",
+			method:        "PUT",
+			path:          path,
+			authorization: bearer(aliceToken),
+			body:          map[string]string{"body": strings.Repeat("a", 141)},
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "Edit without body",
+			method:        "PUT",
+			path:          path,
+			authorization: bearer(aliceToken),
+			body:          map[string]string{},
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "Edit unchanged",
+			method:        "PUT",
+			path:          path,
+			authorization: bearer(aliceToken),
+			body:          map[string]string{"body": "Helo world"},
+			wantStatus:    http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if got := decode[Chirp](t, rec); !reflect.DeepEqual(got, chirp) {
+					t.Errorf("chirp = %+v, want %+v", got, chirp)
+				}
+			},
+		},
+		{
+			name:          "Edit own chirp",
+			method:        "PUT",
+			path:          path,
+			authorization: bearer(aliceToken),
+			body:          map[string]string{"body": "Hello world"},
+			wantStatus:    http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				got := decode[Chirp](t, rec)
+				if got.Id != chirp.Id || got.Body != "Hello world" || !got.Edited ||
+					!got.CreatedAt.Equal(chirp.CreatedAt) || !got.UpdatedAt.After(chirp.UpdatedAt) {
+					t.Errorf("chirp = %+v, want edited %+v", got, chirp)
+				}
+			},
+		},
+		{
+			name:          "Edit cleans profanity",
+			method:        "PUT",
+			path:          path,
+			authorization: bearer(aliceToken),
+			body:          map[string]string{"body": "Hello fornax world"},
+			wantStatus:    http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if got := decode[Chirp](t, rec); got.Body != "Hello **** world" {
+					t.Errorf("body = %q", got.Body)
+				}
+			},
+		},
+		{
+			name:       "Get edited chirp",
+			method:     "GET",
+			path:       path,
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if got := decode[Chirp](t, rec); got.Body != "Hello **** world" || !got.Edited {
+					t.Errorf("chirp = %+v", got)
+				}
+			},
+		},
+		{
+			name:       "Revisions oldest first",
+			method:     "GET",
+			path:       path + "/revisions",
+			wantStatus: http.StatusOK,
+			check:      wantRevisions("Helo world", "Hello world"),
+		},
+		{
+			name:       "Revisions of unknown chirp",
+			method:     "GET",
+			path:       "/api/chirps/" + uuid.NewString() + "/revisions",
+			wantStatus: http.StatusNotFound,
+		},
+	})
+}
+
+func TestChirpThreads(t *testing.T) {
+	api := newTestAPI(t, "")
+	api.createUser("alice@example.com", "wonderland")
+	api.createUser("bob@example.com", "builder")
+	aliceToken := api.login("alice@example.com", "wonderland").Token
+	bobToken := api.login("bob@example.com", "builder").Token
+
+	names := map[uuid.UUID]string{}
+	post := func(token, name string, parent *Chirp) Chirp {
+		t.Helper()
+		body := map[string]any{"body": name}
+		if parent != nil {
+			body["in_reply_to"] = parent.Id
+		}
+		rec := api.request("POST", "/api/chirps", bearer(token), body)
+		requireStatus(t, rec, http.StatusCreated)
+		chirp := decode[Chirp](t, rec)
+		names[chirp.Id] = name
+		return chirp
+	}
+	root := post(aliceToken, "root", nil)
+	a := post(bobToken, "a", &root)
+	post(aliceToken, "b", &root)
+	a1 := post(aliceToken, "a1", &a)
+	post(bobToken, "a1x", &a1)
+
+	if a.InReplyTo == nil || *a.InReplyTo != root.Id || a.ParentDeleted {
+		t.Errorf("reply = %+v, want in_reply_to %s", a, root.Id)
+	}
+
+	type thread struct {
+		Ancestors []Chirp        `json:"ancestors"`
+		Chirp     Chirp          `json:"chirp"`
+		Replies   []*threadReply `json:"replies"`
+	}
+	// render writes a tree of replies as names with their replies in
+	// parentheses, e.g. "a(a1(a1x)) b".
+	var render func(replies []*threadReply) string
+	render = func(replies []*threadReply) string {
+		var parts []string
+		for _, reply := range replies {
+			part := names[reply.Id]
+			if len(reply.Replies) > 0 {
+				part += "(" + render(reply.Replies) + ")"
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, " ")
+	}
+	wantThread := func(ancestors []string, chirp string, pages ...string) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			var got []string
+			var gotAncestors []string
+			var gotChirp string
+			for i := 0; ; i++ {
+				th := decode[thread](t, rec)
+				got = append(got, render(th.Replies))
+				gotChirp = names[th.Chirp.Id]
+				gotAncestors = gotAncestors[:0]
+				for _, ancestor := range th.Ancestors {
+					gotAncestors = append(gotAncestors, names[ancestor.Id])
+				}
+				link := rec.Header().Get("Link")
+				if link == "" || i > len(pages) {
+					break
+				}
+				rec = api.request("GET", nextLinkRE.FindStringSubmatch(link)[1], "", nil)
+				requireStatus(t, rec, http.StatusOK)
+			}
+			if gotChirp != chirp || !slices.Equal(gotAncestors, ancestors) || !slices.Equal(got, pages) {
+				t.Errorf("thread = %q < %q > %q, want %q < %q > %q", gotAncestors, gotChirp, got, ancestors, chirp, pages)
+			}
+		}
+	}
+	replyCount := func(want int32) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			if got := decode[Chirp](t, rec).ReplyCount; got != want {
+				t.Errorf("reply_count = %d, want %d", got, want)
+			}
+		}
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:          "Reply to unknown chirp",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(aliceToken),
+			body:          map[string]string{"body": "hello?", "in_reply_to": uuid.NewString()},
+			wantStatus:    http.StatusUnprocessableEntity,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if fields := fieldErrors(t, rec); fields["in_reply_to"] == "" {
+					t.Errorf("fields = %v, want an in_reply_to error", fields)
+				}
+			},
+		},
+		{
+			name:          "Reply to malformed ID",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(aliceToken),
+			body:          map[string]string{"body": "hello?", "in_reply_to": "root"},
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:       "Reply count",
+			method:     "GET",
+			path:       "/api/chirps/" + root.Id.String(),
+			wantStatus: http.StatusOK,
+			check:      replyCount(2),
+		},
+		{
+			name:       "Whole thread",
+			method:     "GET",
+			path:       "/api/chirps/" + root.Id.String() + "/thread",
+			wantStatus: http.StatusOK,
+			check:      wantThread(nil, "root", "a(a1(a1x)) b"),
+		},
+		{
+			name:       "Thread pages",
+			method:     "GET",
+			path:       "/api/chirps/" + root.Id.String() + "/thread?limit=2",
+			wantStatus: http.StatusOK,
+			check:      wantThread(nil, "root", "a(a1)", "a1x b"),
+		},
+		{
+			name:       "Thread of a reply",
+			method:     "GET",
+			path:       "/api/chirps/" + a1.Id.String() + "/thread",
+			wantStatus: http.StatusOK,
+			check:      wantThread([]string{"root", "a"}, "a1", "a1x"),
+		},
+		{
+			name:       "Thread of unknown chirp",
+			method:     "GET",
+			path:       "/api/chirps/" + uuid.NewString() + "/thread",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Thread with invalid cursor",
+			method:     "GET",
+			path:       "/api/chirps/" + root.Id.String() + "/thread?cursor=%21",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "Delete a reply with replies",
+			method:        "DELETE",
+			path:          "/api/chirps/" + a.Id.String(),
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusNoContent,
+		},
+		{
+			name:       "Reply count after delete",
+			method:     "GET",
+			path:       "/api/chirps/" + root.Id.String(),
+			wantStatus: http.StatusOK,
+			check:      replyCount(1),
+		},
+		{
+			name:       "Reply to deleted chirp",
+			method:     "GET",
+			path:       "/api/chirps/" + a1.Id.String(),
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if got := decode[Chirp](t, rec); got.InReplyTo != nil || !got.ParentDeleted {
+					t.Errorf("chirp = %+v, want no in_reply_to and parent_deleted", got)
+				}
+			},
+		},
+		{
+			name:       "Thread after delete",
+			method:     "GET",
+			path:       "/api/chirps/" + root.Id.String() + "/thread",
+			wantStatus: http.StatusOK,
+			check:      wantThread(nil, "root", "b"),
+		},
+		{
+			name:       "Orphaned thread",
+			method:     "GET",
+			path:       "/api/chirps/" + a1.Id.String() + "/thread",
+			wantStatus: http.StatusOK,
+			check:      wantThread(nil, "a1", "a1x"),
+		},
+	})
+}
+
+// likeLookups counts GetLikedChirpIDs calls.
+type likeLookups struct {
+	store.Store
+	calls int
+}
+
+func (s *likeLookups) GetLikedChirpIDs(ctx context.Context, arg database.GetLikedChirpIDsParams) ([]uuid.UUID, error) {
+	s.calls++
+	return s.Store.GetLikedChirpIDs(ctx, arg)
+}
+
+func TestChirpLikes(t *testing.T) {
+	api := newTestAPI(t, "")
+	api.createUser("alice@example.com", "wonderland")
+	bob := api.createUser("bob@example.com", "builder")
+	aliceToken := api.login("alice@example.com", "wonderland").Token
+	bobToken := api.login("bob@example.com", "builder").Token
+	lookups := &likeLookups{Store: api.cfg.db}
+	api.cfg.db = lookups
+
+	first := api.postChirp(aliceToken, "first")
+	second := api.postChirp(aliceToken, "second")
+	likes := func(chirp Chirp) string {
+		return "/api/chirps/" + chirp.Id.String() + "/likes"
+	}
+	wantLike := func(count int32, likedByMe *bool) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			got := decode[Chirp](t, rec)
+			if got.LikeCount != count || !reflect.DeepEqual(got.LikedByMe, likedByMe) {
+				t.Errorf("like_count = %d, liked_by_me = %v; want %d, %v", got.LikeCount, ptrString(got.LikedByMe), count, ptrString(likedByMe))
+			}
+		}
+	}
+	yes, no := true, false
+	wantList := func(want map[uuid.UUID]*bool) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			for _, chirp := range decode[[]Chirp](t, rec) {
+				if want, ok := want[chirp.Id]; ok && !reflect.DeepEqual(chirp.LikedByMe, want) {
+					t.Errorf("chirp %q liked_by_me = %v, want %v", chirp.Body, ptrString(chirp.LikedByMe), ptrString(want))
+				}
+			}
+		}
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:       "Like without token",
+			method:     "POST",
+			path:       likes(first),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Like",
+			method:        "POST",
+			path:          likes(first),
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantLike(1, &yes),
+		},
+		{
+			name:          "Like again",
+			method:        "POST",
+			path:          likes(first),
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantLike(1, &yes),
+		},
+		{
+			name:          "Like own chirp",
+			method:        "POST",
+			path:          likes(first),
+			authorization: bearer(aliceToken),
+			wantStatus:    http.StatusOK,
+			check:         wantLike(2, &yes),
+		},
+		{
+			name:          "Like unknown chirp",
+			method:        "POST",
+			path:          "/api/chirps/" + uuid.NewString() + "/likes",
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:          "Like invalid ID",
+			method:        "POST",
+			path:          "/api/chirps/first/likes",
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "Like second",
+			method:        "POST",
+			path:          likes(second),
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantLike(1, &yes),
+		},
+		{
+			name:       "Anonymous get",
+			method:     "GET",
+			path:       "/api/chirps/" + first.Id.String(),
+			wantStatus: http.StatusOK,
+			check:      wantLike(2, nil),
+		},
+		{
+			name:          "Authenticated get",
+			method:        "GET",
+			path:          "/api/chirps/" + first.Id.String(),
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantLike(2, &yes),
+		},
+		{
+			name:          "Unlike",
+			method:        "DELETE",
+			path:          likes(second),
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantLike(0, &no),
+		},
+		{
+			name:          "Unlike again",
+			method:        "DELETE",
+			path:          likes(second),
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantLike(0, &no),
+		},
+		{
+			name:       "Anonymous list",
+			method:     "GET",
+			path:       "/api/chirps",
+			wantStatus: http.StatusOK,
+			check:      wantList(map[uuid.UUID]*bool{first.Id: nil, second.Id: nil}),
+		},
+		{
+			name:          "Authenticated list",
+			method:        "GET",
+			path:          "/api/chirps",
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantList(map[uuid.UUID]*bool{first.Id: &yes, second.Id: &no}),
+		},
+		{
+			name:       "User likes",
+			method:     "GET",
+			path:       "/api/users/" + bob.Id.String() + "/likes",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				chirps := decode[[]Chirp](t, rec)
+				if len(chirps) != 1 || chirps[0].Id != first.Id {
+					t.Errorf("likes = %+v, want only %s", chirps, first.Id)
+				}
+			},
+		},
+		{
+			name:       "Likes of unknown user",
+			method:     "GET",
+			path:       "/api/users/" + uuid.NewString() + "/likes",
+			wantStatus: http.StatusNotFound,
+		},
+	})
+
+	t.Run("One lookup per page", func(t *testing.T) {
+		for range 5 {
+			api.postChirp(aliceToken, "more")
+		}
+		lookups.calls = 0
+		rec := api.request("GET", "/api/chirps", bearer(bobToken), nil)
+		requireStatus(t, rec, http.StatusOK)
+		if n := len(decode[[]Chirp](t, rec)); n != 7 || lookups.calls != 1 {
+			t.Errorf("listing %d chirps looked up likes %d times, want once", n, lookups.calls)
+		}
+	})
+
+	t.Run("User likes pages", func(t *testing.T) {
+		api.request("POST", likes(second), bearer(bobToken), nil)
+		pages := api.collectPages(t, "/api/users/"+bob.Id.String()+"/likes?limit=1", 3)
+		if want := [][]uuid.UUID{{second.Id}, {first.Id}}; !reflect.DeepEqual(pages, want) {
+			t.Errorf("pages = %v, want %v", pages, want)
+		}
+	})
+}
+
+// ptrString formats an optional value for test failures.
+func ptrString[T any](p *T) string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprint(*p)
+}
+
+func TestRechirps(t *testing.T) {
+	api := newTestAPI(t, "")
+	api.createUser("alice@example.com", "wonderland")
+	api.createUser("bob@example.com", "builder")
+	aliceToken := api.login("alice@example.com", "wonderland").Token
+	bobToken := api.login("bob@example.com", "builder").Token
+
+	original := api.postChirp(aliceToken, "original")
+	rec := api.request("POST", "/api/chirps", bearer(bobToken), map[string]any{"rechirp_of": original.Id})
+	requireStatus(t, rec, http.StatusCreated)
+	rechirp := decode[Chirp](t, rec)
+	rec = api.request("POST", "/api/chirps", bearer(bobToken), map[string]any{"body": "so true", "quote_of": original.Id})
+	requireStatus(t, rec, http.StatusCreated)
+	quote := decode[Chirp](t, rec)
+
+	if rechirp.RechirpOf == nil || *rechirp.RechirpOf != original.Id || rechirp.Body != "" {
+		t.Errorf("rechirp = %+v, want an empty rechirp of %s", rechirp, original.Id)
+	}
+	if rechirp.Original == nil || rechirp.Original.Body != "original" || rechirp.Original.RechirpCount != 1 {
+		t.Errorf("rechirp original = %+v, want the original with one rechirp", rechirp.Original)
+	}
+	if quote.QuoteOf == nil || *quote.QuoteOf != original.Id || quote.Original == nil || quote.Original.Id != original.Id {
+		t.Errorf("quote = %+v, want a quote of %s", quote, original.Id)
+	}
+
+	wantOriginal := func(id uuid.UUID) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			got := decode[Chirp](t, rec)
+			if got.Original == nil || got.Original.Id != id || got.Original.LikedByMe == nil {
+				t.Errorf("original = %+v, want %s with liked_by_me", got.Original, id)
+			}
+		}
+	}
+
+	t.Run("Rechirped concurrently", func(t *testing.T) {
+		db := api.cfg.db
+		api.cfg.db = rechirpRace{Store: db, checked: new(bool)}
+		defer func() { api.cfg.db = db }()
+		rec := api.request("POST", "/api/chirps", bearer(bobToken), map[string]any{"rechirp_of": original.Id})
+		requireStatus(t, rec, http.StatusOK)
+		if got := decode[Chirp](t, rec); got.Id != rechirp.Id {
+			t.Errorf("rechirp = %s, want existing %s", got.Id, rechirp.Id)
+		}
+	})
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:          "Rechirp again",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(bobToken),
+			body:          map[string]any{"rechirp_of": original.Id},
+			wantStatus:    http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if got := decode[Chirp](t, rec); got.Id != rechirp.Id {
+					t.Errorf("rechirp again = %s, want existing %s", got.Id, rechirp.Id)
+				}
+			},
+		},
+		{
+			name:          "Rechirp a rechirp",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(aliceToken),
+			body:          map[string]any{"rechirp_of": rechirp.Id},
+			wantStatus:    http.StatusCreated,
+			check:         wantOriginal(original.Id),
+		},
+		{
+			name:          "Rechirp with body",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(bobToken),
+			body:          map[string]any{"rechirp_of": original.Id, "body": "hey"},
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "Rechirp unknown chirp",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(bobToken),
+			body:          map[string]any{"rechirp_of": uuid.New()},
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "Quote without body",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(bobToken),
+			body:          map[string]any{"quote_of": original.Id},
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "Quote unknown chirp",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(bobToken),
+			body:          map[string]any{"body": "hm", "quote_of": uuid.New()},
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "Edit rechirp",
+			method:        "PUT",
+			path:          "/api/chirps/" + rechirp.Id.String(),
+			authorization: bearer(bobToken),
+			body:          map[string]string{"body": "sneaky"},
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "Get rechirp",
+			method:        "GET",
+			path:          "/api/chirps/" + rechirp.Id.String(),
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantOriginal(original.Id),
+		},
+		{
+			name:       "List renders originals inline",
+			method:     "GET",
+			path:       "/api/chirps",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				for _, chirp := range decode[[]Chirp](t, rec) {
+					if _, shares := chirp.originalID(); shares != (chirp.Original != nil) {
+						t.Errorf("chirp %s original = %+v", chirp.Id, chirp.Original)
+					}
+				}
+			},
+		},
+		{
+			name:          "Original counts",
+			method:        "GET",
+			path:          "/api/chirps/" + original.Id.String(),
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if got := decode[Chirp](t, rec); got.RechirpCount != 2 || got.QuoteCount != 1 {
+					t.Errorf("rechirp_count = %d, quote_count = %d; want 2, 1", got.RechirpCount, got.QuoteCount)
+				}
+			},
+		},
+		{
+			name:          "Delete original",
+			method:        "DELETE",
+			path:          "/api/chirps/" + original.Id.String(),
+			authorization: bearer(aliceToken),
+			wantStatus:    http.StatusNoContent,
+		},
+		{
+			name:       "Rechirp goes with original",
+			method:     "GET",
+			path:       "/api/chirps/" + rechirp.Id.String(),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Quote stays without original",
+			method:     "GET",
+			path:       "/api/chirps/" + quote.Id.String(),
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				got := decode[Chirp](t, rec)
+				if got.QuoteOf != nil || !got.QuoteDeleted || got.Original != nil || got.Body != "so true" {
+					t.Errorf("quote after delete = %+v, want quote_deleted and no original", got)
+				}
+			},
+		},
+	})
+}
+
+// rechirpRace hides the existing rechirp from the first GetRechirp, as if
+// another request rechirped between the check and the insert.
+type rechirpRace struct {
+	store.Store
+	checked *bool
+}
+
+func (s rechirpRace) GetRechirp(ctx context.Context, arg database.GetRechirpParams) (database.Chirp, error) {
+	if !*s.checked {
+		*s.checked = true
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return s.Store.GetRechirp(ctx, arg)
+}
+
+func TestPolkaWebhook(t *testing.T) {
+	api := newTestAPI(t, "")
+	user := api.createUser("lydia@example.com", "methylamine")
+	upgrade := func(userID uuid.UUID) map[string]any {
+		return map[string]any{"event": "user.upgraded", "data": map[string]any{"user_id": userID}}
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:       "Missing API key",
+			method:     "POST",
+			path:       "/api/polka/webhooks",
+			body:       upgrade(user.Id),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Wrong API key",
+			method:        "POST",
+			path:          "/api/polka/webhooks",
+			authorization: "ApiKey wrong",
+			body:          upgrade(user.Id),
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Ignored event",
+			method:        "POST",
+			path:          "/api/polka/webhooks",
+			authorization: "ApiKey " + testPolkaKey,
+			body:          map[string]any{"event": "user.payment_failed", "data": map[string]any{"user_id": user.Id}},
+			wantStatus:    http.StatusNoContent,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if api.login("lydia@example.com", "methylamine").IsChirpyRed {
+					t.Error("user upgraded by an ignored event")
+				}
+			},
+		},
+		{
+			name:          "Unknown user",
+			method:        "POST",
+			path:          "/api/polka/webhooks",
+			authorization: "ApiKey " + testPolkaKey,
+			body:          upgrade(uuid.New()),
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:          "Upgrade",
+			method:        "POST",
+			path:          "/api/polka/webhooks",
+			authorization: "ApiKey " + testPolkaKey,
+			body:          upgrade(user.Id),
+			wantStatus:    http.StatusNoContent,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if !api.login("lydia@example.com", "methylamine").IsChirpyRed {
+					t.Error("user not upgraded")
+				}
+			},
+		},
+	})
+}
+
+func TestAdmin(t *testing.T) {
+	t.Run("Reset outside dev", func(t *testing.T) {
+		api := newTestAPI(t, "prod")
+		adminToken := api.createAdmin("gus@example.com", "chicken")
+		requireStatus(t, api.request("POST", "/admin/reset", bearer(adminToken), nil), http.StatusForbidden)
+	})
+
+	t.Run("Reset in dev", func(t *testing.T) {
+		api := newTestAPI(t, "dev")
+		adminToken := api.createAdmin("gus@example.com", "chicken")
+		api.createUser("hank@example.com", "minerals")
+		requireStatus(t, api.request("GET", "/app/", "", nil), http.StatusOK)
+
+		rec := api.request("GET", "/admin/metrics", bearer(adminToken), nil)
+		requireStatus(t, rec, http.StatusOK)
+		if !strings.Contains(rec.Body.String(), "visited 1 times") {
+			t.Errorf("metrics page = %s", rec.Body.String())
+		}
+
+		requireStatus(t, api.request("POST", "/admin/reset", bearer(adminToken), nil), http.StatusOK)
+		rec = api.request("POST", "/api/login", "", map[string]string{"email": "hank@example.com", "password": "minerals"})
+		requireStatus(t, rec, http.StatusUnauthorized)
+		// The admin was deleted too, so their token no longer works.
+		requireStatus(t, api.request("GET", "/admin/metrics", bearer(adminToken), nil), http.StatusUnauthorized)
+		if api.cfg.fileserverHits.Load() != 0 {
+			t.Error("reset did not clear the hit counter")
+		}
+	})
+
+	t.Run("Admin routes require the admin role", func(t *testing.T) {
+		api := newTestAPI(t, "dev")
+		api.createUser("hank@example.com", "minerals")
+		userToken := api.login("hank@example.com", "minerals").Token
+		for _, route := range []struct{ method, path string }{
+			{"GET", "/admin/metrics"},
+			{"POST", "/admin/reset"},
+			{"GET", "/admin/users"},
+			{"GET", "/admin/users/" + uuid.NewString()},
+			{"GET", "/admin/users/" + uuid.NewString() + "/chirps"},
+			{"GET", "/admin/users/" + uuid.NewString() + "/refresh_tokens"},
+			{"PUT", "/admin/users/" + uuid.NewString() + "/chirpy_red"},
+			{"POST", "/admin/users/" + uuid.NewString() + "/unlock"},
+		} {
+			rec := api.request(route.method, route.path, "", nil)
+			requireStatus(t, rec, http.StatusUnauthorized)
+			rec = api.request(route.method, route.path, bearer(userToken), nil)
+			requireStatus(t, rec, http.StatusForbidden)
+			if code := problemCode(t, rec); code != "forbidden_not_admin" {
+				t.Errorf("%s %s code = %q, want forbidden_not_admin", route.method, route.path, code)
+			}
+		}
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		api := newTestAPI(t, "")
+		adminToken := bearer(api.createAdmin("gus@example.com", "chicken"))
+		hank := api.createUser("hank@example.com", "minerals")
+		marie := api.createUser("marie@example.net", "purple")
+		hankToken := api.login("hank@example.com", "minerals").Token
+		chirp := api.postChirp(hankToken, "Jesus Marie")
+		userPath := "/admin/users/" + hank.Id.String()
+
+		runAPITests(t, api, []apiTest{
+			{
+				name:          "List users",
+				method:        "GET",
+				path:          "/admin/users",
+				authorization: adminToken,
+				wantStatus:    http.StatusOK,
+				check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					users := decode[[]AdminUser](t, rec)
+					if len(users) != 3 || !users[0].IsAdmin || users[1].Id != hank.Id || users[1].IsAdmin {
+						t.Errorf("users = %+v", users)
+					}
+				},
+			},
+			{
+				name:          "Search users",
+				method:        "GET",
+				path:          "/admin/users?q=.net&limit=10",
+				authorization: adminToken,
+				wantStatus:    http.StatusOK,
+				check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					if users := decode[[]AdminUser](t, rec); len(users) != 1 || users[0].Id != marie.Id {
+						t.Errorf("users = %+v", users)
+					}
+				},
+			},
+			{
+				name:          "Search users for a LIKE wildcard",
+				method:        "GET",
+				path:          "/admin/users?q=_",
+				authorization: adminToken,
+				wantStatus:    http.StatusOK,
+				check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					if users := decode[[]AdminUser](t, rec); len(users) != 0 {
+						t.Errorf("users = %+v", users)
+					}
+				},
+			},
+			{
+				name:          "Paginate users",
+				method:        "GET",
+				path:          "/admin/users?limit=1&offset=2",
+				authorization: adminToken,
+				wantStatus:    http.StatusOK,
+				check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					if users := decode[[]AdminUser](t, rec); len(users) != 1 || users[0].Id != marie.Id {
+						t.Errorf("users = %+v", users)
+					}
+				},
+			},
+			{
+				name:          "Invalid limit",
+				method:        "GET",
+				path:          "/admin/users?limit=0",
+				authorization: adminToken,
+				wantStatus:    http.StatusUnprocessableEntity,
+			},
+			{
+				name:          "Get user",
+				method:        "GET",
+				path:          userPath,
+				authorization: adminToken,
+				wantStatus:    http.StatusOK,
+				check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					if user := decode[AdminUser](t, rec); user.Id != hank.Id || *user.Email != "hank@example.com" {
+						t.Errorf("user = %+v", user)
+					}
+				},
+			},
+			{
+				name:          "Get unknown user",
+				method:        "GET",
+				path:          "/admin/users/" + uuid.NewString(),
+				authorization: adminToken,
+				wantStatus:    http.StatusNotFound,
+			},
+			{
+				name:          "Get user chirps",
+				method:        "GET",
+				path:          userPath + "/chirps",
+				authorization: adminToken,
+				wantStatus:    http.StatusOK,
+				check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					if chirps := decode[[]Chirp](t, rec); len(chirps) != 1 || chirps[0].Id != chirp.Id {
+						t.Errorf("chirps = %+v", chirps)
+					}
+				},
+			},
+			{
+				name:          "Get user chirps with invalid cursor",
+				method:        "GET",
+				path:          userPath + "/chirps?cursor=nonsense",
+				authorization: adminToken,
+				wantStatus:    http.StatusUnprocessableEntity,
+			},
+			{
+				name:          "Get user refresh tokens",
+				method:        "GET",
+				path:          userPath + "/refresh_tokens",
+				authorization: adminToken,
+				wantStatus:    http.StatusOK,
+				check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					var tokens []map[string]any
+					if err := json.Unmarshal(rec.Body.Bytes(), &tokens); err != nil {
+						t.Fatal(err)
+					}
+					if len(tokens) != 1 || len(tokens[0]["token_prefix"].(string)) != 8 || tokens[0]["token"] != nil {
+						t.Errorf("tokens = %+v", tokens)
+					}
+				},
+			},
+			{
+				name:          "Grant Chirpy Red",
+				method:        "PUT",
+				path:          userPath + "/chirpy_red",
+				authorization: adminToken,
+				body:          map[string]bool{"is_chirpy_red": true},
+				wantStatus:    http.StatusOK,
+				check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					if user := decode[AdminUser](t, rec); !user.IsChirpyRed {
+						t.Errorf("user = %+v", user)
+					}
+				},
+			},
+			{
+				name:          "Revoke Chirpy Red",
+				method:        "PUT",
+				path:          userPath + "/chirpy_red",
+				authorization: adminToken,
+				body:          map[string]bool{"is_chirpy_red": false},
+				wantStatus:    http.StatusOK,
+				check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					if user := decode[AdminUser](t, rec); user.IsChirpyRed {
+						t.Errorf("user = %+v", user)
+					}
+				},
+			},
+			{
+				name:          "Chirpy Red without value",
+				method:        "PUT",
+				path:          userPath + "/chirpy_red",
+				authorization: adminToken,
+				body:          map[string]bool{},
+				wantStatus:    http.StatusUnprocessableEntity,
+			},
+		})
+
+		second := api.postChirp(hankToken, "Minerals")
+		var pages [][]uuid.UUID
+		for path := userPath + "/chirps?limit=1"; path != ""; {
+			rec := api.request("GET", path, adminToken, nil)
+			requireStatus(t, rec, http.StatusOK)
+			var ids []uuid.UUID
+			for _, c := range decode[[]Chirp](t, rec) {
+				ids = append(ids, c.Id)
+			}
+			pages = append(pages, ids)
+			path = ""
+			if m := nextLinkRE.FindStringSubmatch(rec.Header().Get("Link")); m != nil && len(pages) < 5 {
+				path = m[1]
+			}
+		}
+		if want := [][]uuid.UUID{{chirp.Id}, {second.Id}}; !reflect.DeepEqual(pages, want) {
+			t.Errorf("user chirp pages = %v, want %v", pages, want)
+		}
+	})
+}
+
+func mustMakeJWT(t *testing.T, userID uuid.UUID, secret string) string {
+	t.Helper()
+	token, err := auth.MakeJWT(userID, secret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRequestLogging(t *testing.T) {
+	api := newTestAPI(t, "")
+	user := api.createUser("gale@example.com", "karaoke")
+	token := api.login("gale@example.com", "karaoke").Token
+
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	req := httptest.NewRequest("POST", "/api/chirps", strings.NewReader(`{"body":"lab notes"}`))
+	req.Header.Set("Authorization", bearer(token))
+	req.Header.Set(requestIDHeader, "client-id-42")
+	rec := httptest.NewRecorder()
+	api.handler.ServeHTTP(rec, req)
+	requireStatus(t, rec, http.StatusCreated)
+	if got := rec.Header().Get(requestIDHeader); got != "client-id-42" {
+		t.Errorf("%s = %q, want the client supplied ID", requestIDHeader, got)
+	}
+
+	var entry struct {
+		Msg       string `json:"msg"`
+		RequestID string `json:"request_id"`
+		Method    string `json:"method"`
+		Route     string `json:"route"`
+		Status    int    `json:"status"`
+		UserID    string `json:"user_id"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("decoding access log %q: %v", logs.String(), err)
+	}
+	if entry.Msg != "request" || entry.RequestID != "client-id-42" || entry.Route != "POST /api/chirps" ||
+		entry.Status != http.StatusCreated || entry.UserID != user.Id.String() {
+		t.Errorf("access log = %+v", entry)
+	}
+
+	req = httptest.NewRequest("GET", "/api/chirps/"+uuid.NewString(), nil)
+	req.Header.Set(requestIDHeader, "not valid\n")
+	rec = httptest.NewRecorder()
+	api.handler.ServeHTTP(rec, req)
+	requireStatus(t, rec, http.StatusNotFound)
+	id := rec.Header().Get(requestIDHeader)
+	if _, err := uuid.Parse(id); err != nil {
+		t.Errorf("%s = %q, want a generated UUID", requestIDHeader, id)
+	}
+	body := decode[struct {
+		RequestID string `json:"request_id"`
+	}](t, rec)
+	if body.RequestID != id {
+		t.Errorf("error response request_id = %q, want %q", body.RequestID, id)
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	api := newTestAPI(t, "")
+	api.createUser("todd@example.com", "tarantula")
+	token := api.login("todd@example.com", "tarantula").Token
+	api.postChirp(token, "desert")
+	requireStatus(t, api.request("POST", "/api/login", "", map[string]string{"email": "todd@example.com", "password": "wrong"}), http.StatusUnauthorized)
+	requireStatus(t, api.request("POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey, map[string]any{"event": "user.downgraded"}), http.StatusNoContent)
+	requireStatus(t, api.request("BREW", "/coffee", "", nil), http.StatusNotFound)
+
+	rec := api.request("GET", "/metrics", "", nil)
+	requireStatus(t, rec, http.StatusOK)
+	for _, want := range []string{
+		`chirpy_http_requests_total{method="POST",route="POST /api/chirps",status="201"} 1`,
+		`chirpy_http_requests_total{method="other",route="unmatched",status="404"} 1`,
+		`chirpy_http_request_duration_seconds_count{method="POST",route="POST /api/login",status="200"} 1`,
+		`chirpy_logins_total{result="success"} 1`,
+		`chirpy_logins_total{result="failure"} 1`,
+		`chirpy_chirps_created_total 1`,
+		`chirpy_webhook_events_total{event="other",result="ignored"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics output does not contain %q", want)
+		}
+	}
+
+}
+
+func TestRateLimitPatterns(t *testing.T) {
+	defaults, err := config.Load(nil, func(key string) string {
+		return map[string]string{"STORE": "memory", "JWT_SECRET": "secret", "POLKA_KEY": "key"}[key]
+	})
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		limits  map[string]ratelimit.Limit
+		wantErr string
+	}{
+		{name: "Defaults", limits: defaults.RateLimits},
+		{name: "Unknown route", limits: map[string]ratelimit.Limit{
+			"POST /api/chirps": {Burst: 1, Period: time.Minute},
+			"POST /api/chirp":  {Burst: 1, Period: time.Minute},
+		}, wantErr: `RATE_LIMITS: "POST /api/chirp" matches no route`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := testConfig()
+			conf.RateLimits = tt.limits
+			cfg := newAPIConfig(conf, store.NewMemory(), ratelimit.NewMemory(), newMetrics())
+			defer cfg.stopWorkers()
+			_, err := cfg.routes(".")
+			if got := fmt.Sprint(err); (tt.wantErr == "" && err != nil) || (tt.wantErr != "" && got != tt.wantErr) {
+				t.Errorf("routes() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRateLimiting(t *testing.T) {
+	conf := testConfig()
+	conf.RateLimits = map[string]ratelimit.Limit{
+		"POST /api/users":  {Burst: 3, Period: time.Hour},
+		"POST /api/chirps": {Burst: 1, Period: time.Hour},
+	}
+	api := newTestAPIWithConfig(t, conf)
+	api.createUser("skyler@example.com", "carwash")
+	api.createUser("marie@example.com", "purple")
+	skylerToken := api.login("skyler@example.com", "carwash").Token
+	marieToken := api.login("marie@example.com", "purple").Token
+
+	rec := api.request("POST", "/api/users", "", map[string]string{"email": "flynn@example.com", "password": "breakfast"})
+	requireStatus(t, rec, http.StatusCreated)
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want %q", got, "0")
+	}
+
+	rec = api.request("POST", "/api/users", "", map[string]string{"email": "holly@example.com", "password": "baby"})
+	requireStatus(t, rec, http.StatusTooManyRequests)
+	if got := rec.Header().Get("Retry-After"); got != "1200" {
+		t.Errorf("Retry-After = %q, want %q", got, "1200")
+	}
+	if got := rec.Header().Get("RateLimit-Limit"); got != "3" {
+		t.Errorf("RateLimit-Limit = %q, want %q", got, "3")
+	}
+
+	// Authenticated requests are limited per user rather than per IP.
+	api.postChirp(skylerToken, "Cash flow")
+	api.postChirp(marieToken, "Rocks, not minerals")
+	rec = api.request("POST", "/api/chirps", bearer(skylerToken), map[string]string{"body": "Again"})
+	requireStatus(t, rec, http.StatusTooManyRequests)
+
+	// Routes without a configured limit are not limited.
+	for range 5 {
+		requireStatus(t, api.request("GET", "/api/chirps", "", nil), http.StatusOK)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		xff        []string
+		want       string
+	}{
+		{name: "Remote address", want: "192.0.2.1"},
+		{name: "Proxy headers ignored by default", xff: []string{"203.0.113.7"}, want: "192.0.2.1"},
+		{name: "Right-most forwarded address", trustProxy: true, xff: []string{"10.0.0.1, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "Last header wins", trustProxy: true, xff: []string{"10.0.0.1", "203.0.113.8"}, want: "203.0.113.8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{trustProxyHeaders: tt.trustProxy}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := cfg.clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	conf := testConfig()
+	conf.LoginDelayAfter = 3
+	conf.LoginLockoutAfter = 3
+	api := newTestAPIWithConfig(t, conf)
+	walt := api.createUser("walt@example.com", "heisenberg")
+
+	for _, email := range []string{"walt@example.com", "nobody@example.com"} {
+		for range 3 {
+			rec := api.request("POST", "/api/login", "", map[string]string{"email": email, "password": "wrong"})
+			requireStatus(t, rec, http.StatusUnauthorized)
+			// Unknown emails must be indistinguishable from wrong passwords.
+			if got := problemCode(t, rec); got != "invalid_credentials" {
+				t.Errorf("code = %q, want %q", got, "invalid_credentials")
+			}
+		}
+		rec := api.request("POST", "/api/login", "", map[string]string{"email": email, "password": "wrong"})
+		requireStatus(t, rec, http.StatusTooManyRequests)
+		if got := rec.Header().Get("Retry-After"); got != "900" {
+			t.Errorf("Retry-After = %q, want %q", got, "900")
+		}
+	}
+
+	// Even the right password is rejected while the account is locked, and
+	// the lockout ignores the case of the email.
+	rec := api.request("POST", "/api/login", "", map[string]string{"email": "WALT@example.com", "password": "heisenberg"})
+	requireStatus(t, rec, http.StatusTooManyRequests)
+
+	adminToken := bearer(api.createAdmin("gus@example.com", "chicken"))
+	unlockPath := "/admin/users/" + walt.Id.String() + "/unlock"
+	runAPITests(t, api, []apiTest{
+		{
+			name:          "Unlock invalid user ID",
+			method:        "POST",
+			path:          "/admin/users/not-a-uuid/unlock",
+			authorization: adminToken,
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "Unlock unknown user",
+			method:        "POST",
+			path:          "/admin/users/" + uuid.NewString() + "/unlock",
+			authorization: adminToken,
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:          "Unlock user",
+			method:        "POST",
+			path:          unlockPath,
+			authorization: adminToken,
+			wantStatus:    http.StatusNoContent,
+		},
+	})
+	api.login("walt@example.com", "heisenberg")
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	conf := testConfig()
+	conf.LoginIPLockoutAfter = 2
+	api := newTestAPIWithConfig(t, conf)
+	api.createUser("jesse@example.com", "yo")
+
+	for _, email := range []string{"gus@example.com", "mike@example.com"} {
+		rec := api.request("POST", "/api/login", "", map[string]string{"email": email, "password": "wrong"})
+		requireStatus(t, rec, http.StatusUnauthorized)
+	}
+	rec := api.request("POST", "/api/login", "", map[string]string{"email": "jesse@example.com", "password": "yo"})
+	requireStatus(t, rec, http.StatusTooManyRequests)
+}
+
+func TestLoginPolicy(t *testing.T) {
+	policy := loginPolicy{
+		DelayAfter:      3,
+		Delay:           time.Second,
+		MaxDelay:        5 * time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		IPLockoutAfter:  100,
+	}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: time.Second},
+		{failures: 5, want: 2 * time.Second},
+		{failures: 6, want: 4 * time.Second},
+		{failures: 7, want: 5 * time.Second},
+		{failures: 9, want: 5 * time.Second},
+		{failures: 10, want: 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.accountLock(tt.failures); got != tt.want {
+			t.Errorf("accountLock(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+	if got := policy.ipLock(99); got != 0 {
+		t.Errorf("ipLock(99) = %v, want 0", got)
+	}
+	if got := policy.ipLock(100); got != 15*time.Minute {
+		t.Errorf("ipLock(100) = %v, want %v", got, 15*time.Minute)
+	}
+}
+
+func fieldErrors(t *testing.T, rec *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+	resp := decode[struct {
+		Fields []validate.FieldError `json:"fields"`
+	}](t, rec)
+	fields := make(map[string]string, len(resp.Fields))
+	for _, f := range resp.Fields {
+		fields[f.Field] = f.Message
+	}
+	return fields
+}
+
+func TestRequestValidation(t *testing.T) {
+	api := newTestAPI(t, "")
+	api.createUser("hank@example.com", "minerals")
+	token := api.login("hank@example.com", "minerals").Token
+
+	wantFields := func(want map[string]string) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			if got := fieldErrors(t, rec); !reflect.DeepEqual(got, want) {
+				t.Errorf("fields = %v, want %v", got, want)
+			}
+		}
+	}
+	wantDetail := func(want string) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			if got := decodeProblem(t, rec).Detail; got != want {
+				t.Errorf("detail = %q, want %q", got, want)
+			}
+		}
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:       "Create user without fields",
+			method:     "POST",
+			path:       "/api/users",
+			body:       map[string]string{},
+			wantStatus: http.StatusUnprocessableEntity,
+			check:      wantFields(map[string]string{"email": "is required", "password": "is required"}),
+		},
+		{
+			name:       "Create user with invalid email and long password",
+			method:     "POST",
+			path:       "/api/users",
+			body:       map[string]string{"email": "marie", "password": strings.Repeat("x", 73)},
+			wantStatus: http.StatusUnprocessableEntity,
+			check: wantFields(map[string]string{
+				"email":    "must be a valid email address",
+				"password": "must be at most 72 bytes long",
+			}),
+		},
+		{
+			name:       "Malformed JSON",
+			method:     "POST",
+			path:       "/api/users",
+			body:       `{"email": `,
+			wantStatus: http.StatusBadRequest,
+			check:      wantDetail("Request body contains malformed JSON"),
+		},
+		{
+			name:       "Empty body",
+			method:     "POST",
+			path:       "/api/login",
+			body:       "",
+			wantStatus: http.StatusBadRequest,
+			check:      wantDetail("Request body must not be empty"),
+		},
+		{
+			name:       "Unknown field",
+			method:     "POST",
+			path:       "/api/login",
+			body:       map[string]string{"email": "hank@example.com", "password": "minerals", "admin": "true"},
+			wantStatus: http.StatusBadRequest,
+			check:      wantDetail(`Request body contains unknown field "admin"`),
+		},
+		{
+			name:       "Wrong type",
+			method:     "POST",
+			path:       "/api/login",
+			body:       map[string]any{"email": 42, "password": "minerals"},
+			wantStatus: http.StatusBadRequest,
+			check:      wantDetail(`Field "email" must be of type string`),
+		},
+		{
+			name:       "Trailing data",
+			method:     "POST",
+			path:       "/api/login",
+			body:       `{"email": "hank@example.com", "password": "minerals"} {}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Login without password",
+			method:     "POST",
+			path:       "/api/login",
+			body:       map[string]string{"email": "hank@example.com"},
+			wantStatus: http.StatusUnprocessableEntity,
+			check:      wantFields(map[string]string{"password": "is required"}),
+		},
+		{
+			name:          "Update user without fields",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(token),
+			body:          map[string]string{"password": ""},
+			wantStatus:    http.StatusUnprocessableEntity,
+			check:         wantFields(map[string]string{"email": "is required", "password": "is required"}),
+		},
+		{
+			name:          "Chirp without body",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(token),
+			body:          map[string]string{},
+			wantStatus:    http.StatusUnprocessableEntity,
+			check:         wantFields(map[string]string{"body": "is required"}),
+		},
+		{
+			name:          "Body too large",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(token),
+			body:          map[string]string{"body": strings.Repeat("a", maxBodyBytes)},
+			wantStatus:    http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:          "Webhook without event",
+			method:        "POST",
+			path:          "/api/polka/webhooks",
+			authorization: "ApiKey " + testPolkaKey,
+			body:          map[string]any{"data": map[string]any{}},
+			wantStatus:    http.StatusUnprocessableEntity,
+			check:         wantFields(map[string]string{"event": "is required"}),
+		},
+		{
+			name:          "Upgrade webhook without user",
+			method:        "POST",
+			path:          "/api/polka/webhooks",
+			authorization: "ApiKey " + testPolkaKey,
+			body:          map[string]any{"event": "user.upgraded", "data": map[string]any{}},
+			wantStatus:    http.StatusUnprocessableEntity,
+			check:         wantFields(map[string]string{"data.user_id": "is required"}),
+		},
+		{
+			name:          "Webhook tolerates unknown fields",
+			method:        "POST",
+			path:          "/api/polka/webhooks",
+			authorization: "ApiKey " + testPolkaKey,
+			body:          map[string]any{"event": "user.downgraded", "data": map[string]any{}, "sent_at": "now"},
+			wantStatus:    http.StatusNoContent,
+		},
+	})
+}
+
+func TestProblemResponses(t *testing.T) {
+	api := newTestAPI(t, "")
+	alice := api.createUser("alice@example.com", "wonderland")
+	api.createUser("bob@example.com", "builder")
+	aliceToken := api.login("alice@example.com", "wonderland").Token
+	bobToken := api.login("bob@example.com", "builder").Token
+	chirp := api.postChirp(aliceToken, "Curiouser and curiouser")
+
+	expired, err := auth.MakeJWT(alice.Id, testJWTSecret, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCode := func(want string) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			doc := decodeProblem(t, rec)
+			if doc.Code != want || doc.Type != problemTypePrefix+want || doc.Status != rec.Code || doc.Title == "" {
+				t.Errorf("problem = %+v, want code %q", doc, want)
+			}
+			if !strings.HasPrefix(doc.Instance, "/api/") {
+				t.Errorf("instance = %q", doc.Instance)
+			}
+		}
+	}
+
+	chirpPath := "/api/chirps/" + chirp.Id.String()
+	runAPITests(t, api, []apiTest{
+		{
+			name:       "Missing token",
+			method:     "DELETE",
+			path:       chirpPath,
+			wantStatus: http.StatusUnauthorized,
+			check:      wantCode("missing_token"),
+		},
+		{
+			name:          "Malformed token",
+			method:        "DELETE",
+			path:          chirpPath,
+			authorization: bearer("not-a-jwt"),
+			wantStatus:    http.StatusUnauthorized,
+			check:         wantCode("invalid_token"),
+		},
+		{
+			name:          "Expired token",
+			method:        "DELETE",
+			path:          chirpPath,
+			authorization: bearer(expired),
+			wantStatus:    http.StatusUnauthorized,
+			check:         wantCode("token_expired"),
+		},
+		{
+			name:          "Not the owner",
+			method:        "DELETE",
+			path:          chirpPath,
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusForbidden,
+			check:         wantCode("forbidden_not_owner"),
+		},
+		{
+			name:       "Invalid ID",
+			method:     "GET",
+			path:       "/api/chirps/not-a-uuid",
+			wantStatus: http.StatusBadRequest,
+			check:      wantCode("invalid_id"),
+		},
+		{
+			name:       "Chirp not found",
+			method:     "GET",
+			path:       "/api/chirps/" + uuid.NewString(),
+			wantStatus: http.StatusNotFound,
+			check:      wantCode("chirp_not_found"),
+		},
+		{
+			name:          "Unknown refresh token",
+			method:        "POST",
+			path:          "/api/refresh",
+			authorization: bearer("unknown"),
+			wantStatus:    http.StatusUnauthorized,
+			check:         wantCode("invalid_token"),
+		},
+		{
+			name:       "Invalid author filter",
+			method:     "GET",
+			path:       "/api/chirps?author_id=alice",
+			wantStatus: http.StatusUnprocessableEntity,
+			check:      wantCode("invalid_parameters"),
+		},
+		{
+			name:          "Wrong webhook key",
+			method:        "POST",
+			path:          "/api/polka/webhooks",
+			authorization: "ApiKey wrong",
+			wantStatus:    http.StatusUnauthorized,
+			check:         wantCode("invalid_api_key"),
+		},
+	})
+}
+
+// TestProblemCatalogue keeps docs/errors.md in sync with the codes the API
+// can return.
+func TestProblemCatalogue(t *testing.T) {
+	source, err := os.ReadFile("problems.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := os.ReadFile("docs/errors.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := regexp.MustCompile(`problem\{(\d+), "(\w+)"`).FindAllStringSubmatch(string(source), -1)
+	if len(codes) == 0 {
+		t.Fatal("no problems found in problems.go")
+	}
+	seen := make(map[string]bool)
+	for _, m := range codes {
+		status, code := m[1], m[2]
+		if seen[code] {
+			t.Errorf("code %q is used by more than one problem", code)
+		}
+		seen[code] = true
+		row := regexp.MustCompile("(?m)^\\| `" + code + "` +\\| " + status + " ")
+		if !row.Match(doc) {
+			t.Errorf("docs/errors.md does not document %q with status %s", code, status)
+		}
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	cfg := newTestAPI(t, "").cfg
+	userID := uuid.New()
+	token := mustMakeJWT(t, userID, testJWTSecret)
+
+	tests := []struct {
+		name          string
+		req           authRequirement
+		authorization string
+		wantStatus    int
+		wantCode      string
+		wantUser      uuid.UUID
+	}{
+		{name: "None ignores header", req: authNone, authorization: bearer("garbage"), wantStatus: http.StatusOK},
+		{name: "Optional without token", req: authOptional, wantStatus: http.StatusOK},
+		{name: "Optional with token", req: authOptional, authorization: bearer(token), wantStatus: http.StatusOK, wantUser: userID},
+		{name: "Optional with invalid token", req: authOptional, authorization: bearer("garbage"), wantStatus: http.StatusUnauthorized, wantCode: "invalid_token"},
+		{name: "Optional with API key", req: authOptional, authorization: "ApiKey " + testPolkaKey, wantStatus: http.StatusUnauthorized, wantCode: "invalid_token"},
+		{name: "Required without token", req: authRequired, wantStatus: http.StatusUnauthorized, wantCode: "missing_token"},
+		{name: "Required with token", req: authRequired, authorization: bearer(token), wantStatus: http.StatusOK, wantUser: userID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser uuid.UUID
+			handler := cfg.middlewareAuth(tt.req, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUser, _ = auth.UserID(r.Context())
+			}))
+			req := httptest.NewRequest("GET", "/api/chirps", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			requireStatus(t, rec, tt.wantStatus)
+			if tt.wantCode != "" {
+				if code := problemCode(t, rec); code != tt.wantCode {
+					t.Errorf("code = %q, want %q", code, tt.wantCode)
+				}
+			}
+			if gotUser != tt.wantUser {
+				t.Errorf("user = %v, want %v", gotUser, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	conf := testConfig()
+	conf.CORS = cors.Options{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		ExposedHeaders: []string{"X-Request-ID"},
+		MaxAge:         time.Hour,
+	}
+	api := newTestAPIWithConfig(t, conf)
+
+	send := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		api.handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("OPTIONS", "/api/chirps", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "authorization,content-type",
+	})
+	requireStatus(t, rec, http.StatusNoContent)
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type",
+		"Access-Control-Max-Age":       "3600",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("preflight %s = %q, want %q", header, got, want)
+		}
+	}
+
+	rec = send("GET", "/api/chirps", nil)
+	requireStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-ID" {
+		t.Errorf("Access-Control-Expose-Headers = %q", got)
+	}
+
+	// Errors must carry CORS headers too, or browsers hide them from scripts.
+	rec = send("POST", "/api/chirps", nil)
+	requireStatus(t, rec, http.StatusUnauthorized)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("error Access-Control-Allow-Origin = %q", got)
+	}
+
+	rec = send("GET", "/admin/metrics", nil)
+	requireStatus(t, rec, http.StatusUnauthorized)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("admin Access-Control-Allow-Origin = %q, want none", got)
+	}
+}
+
+var nextLinkRE = regexp.MustCompile(`^<([^>]+)>; rel="next"$`)
+
+func TestChirpPagination(t *testing.T) {
+	api := newTestAPI(t, "")
+	api.createUser("alice@example.com", "wonderland")
+	api.createUser("bob@example.com", "builder")
+	aliceToken := api.login("alice@example.com", "wonderland").Token
+	bobToken := api.login("bob@example.com", "builder").Token
+	alice := api.login("alice@example.com", "wonderland").User
+
+	var all, alices []uuid.UUID
+	var created []time.Time
+	for i := range 5 {
+		token := aliceToken
+		if i%2 == 1 {
+			token = bobToken
+		}
+		chirp := api.postChirp(token, fmt.Sprintf("chirp %d", i))
+		all = append(all, chirp.Id)
+		created = append(created, chirp.CreatedAt)
+		if chirp.UserID == alice.Id {
+			alices = append(alices, chirp.Id)
+		}
+	}
+
+	bob := api.login("bob@example.com", "builder").User
+	reversed := slices.Clone(all)
+	slices.Reverse(reversed)
+
+	tests := []struct {
+		name string
+		path string
+		want [][]uuid.UUID
+	}{
+		{name: "Single page", path: "/api/chirps", want: [][]uuid.UUID{all}},
+		{name: "Pages of two", path: "/api/chirps?limit=2", want: [][]uuid.UUID{all[:2], all[2:4], all[4:]}},
+		{name: "Exact pages", path: "/api/chirps?limit=5", want: [][]uuid.UUID{all}},
+		{name: "Filter kept across pages", path: "/api/chirps?limit=2&author_id=" + alice.Id.String(), want: [][]uuid.UUID{alices[:2], alices[2:]}},
+		{name: "Descending", path: "/api/chirps?sort=desc", want: [][]uuid.UUID{reversed}},
+		{name: "Descending pages of two", path: "/api/chirps?sort=desc&limit=2", want: [][]uuid.UUID{reversed[:2], reversed[2:4], reversed[4:]}},
+		{name: "Explicit ascending", path: "/api/chirps?sort=asc&limit=3", want: [][]uuid.UUID{all[:3], all[3:]}},
+		{name: "Comma-separated authors", path: "/api/chirps?author_id=" + alice.Id.String() + "," + bob.Id.String(), want: [][]uuid.UUID{all}},
+		{name: "Repeated authors", path: "/api/chirps?author_id=" + alice.Id.String() + "&author_id=" + bob.Id.String(), want: [][]uuid.UUID{all}},
+		{name: "Since and until", path: "/api/chirps?since=" + timeParam(created[1]) + "&until=" + timeParam(created[3]), want: [][]uuid.UUID{all[1:3]}},
+		{name: "Until descending", path: "/api/chirps?sort=desc&until=" + timeParam(created[2]), want: [][]uuid.UUID{{all[1], all[0]}}},
+		{name: "Since ID", path: "/api/chirps?limit=2&since_id=" + all[1].String(), want: [][]uuid.UUID{all[2:4], all[4:]}},
+		{name: "Since ID descending", path: "/api/chirps?sort=desc&limit=2&since_id=" + all[1].String(), want: [][]uuid.UUID{reversed[:2], reversed[2:3]}},
+		{name: "Since ID of newest", path: "/api/chirps?since_id=" + all[4].String(), want: [][]uuid.UUID{nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := api.collectPages(t, tt.path, len(all)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:       "Limit above maximum",
+			method:     "GET",
+			path:       fmt.Sprintf("/api/chirps?limit=%d", maxChirpPageSize+1),
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Invalid cursor",
+			method:     "GET",
+			path:       "/api/chirps?cursor=not-a-cursor",
+			wantStatus: http.StatusUnprocessableEntity,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if fields := fieldErrors(t, rec); fields["cursor"] == "" {
+					t.Errorf("fields = %v, want a cursor error", fields)
+				}
+			},
+		},
+	})
+
+	invalid := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{name: "Unknown sort", query: "sort=newest", field: "sort"},
+		{name: "Invalid author", query: "author_id=" + alice.Id.String() + ",nobody", field: "author_id"},
+		{name: "Invalid since", query: "since=yesterday", field: "since"},
+		{name: "Invalid until", query: "until=2024-13-01T00:00:00Z", field: "until"},
+		{name: "Empty window", query: "since=" + timeParam(created[3]) + "&until=" + timeParam(created[1]), field: "until"},
+		{name: "Invalid since ID", query: "since_id=42", field: "since_id"},
+		{name: "Unknown since ID", query: "since_id=" + uuid.NewString(), field: "since_id"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.request("GET", "/api/chirps?"+tt.query, "", nil)
+			requireStatus(t, rec, http.StatusUnprocessableEntity)
+			if fields := fieldErrors(t, rec); fields[tt.field] == "" {
+				t.Errorf("fields = %v, want a %s error", fields, tt.field)
+			}
+		})
+	}
+}
+
+// timeParam formats t as a query parameter value.
+func timeParam(t time.Time) string {
+	return url.QueryEscape(t.Format(time.RFC3339Nano))
+}
+
+func TestChirpSearch(t *testing.T) {
+	api := newTestAPI(t, "")
+	api.createUser("alice@example.com", "wonderland")
+	api.createUser("bob@example.com", "builder")
+	aliceToken := api.login("alice@example.com", "wonderland").Token
+	bobToken := api.login("bob@example.com", "builder").Token
+	alice := api.login("alice@example.com", "wonderland").User
+
+	var ids []uuid.UUID
+	for i, body := range []string{
+		"Gophers love generic types",
+		"gophers gophers everywhere",
+		"Types are generic, said the gopher",
+		"Nothing to see here",
+	} {
+		token := aliceToken
+		if i%2 == 1 {
+			token = bobToken
+		}
+		ids = append(ids, api.postChirp(token, body).Id)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want [][]uuid.UUID
+	}{
+		{name: "Most relevant first", path: "/api/chirps/search?q=gophers", want: [][]uuid.UUID{{ids[1], ids[0]}}},
+		{name: "Relevance pages", path: "/api/chirps/search?q=generic&limit=1", want: [][]uuid.UUID{{ids[0]}, {ids[2]}}},
+		{name: "Recent", path: "/api/chirps/search?q=generic&sort=recent", want: [][]uuid.UUID{{ids[2], ids[0]}}},
+		{name: "Recent pages", path: "/api/chirps/search?q=gopher*&sort=recent&limit=2", want: [][]uuid.UUID{{ids[2], ids[1]}, {ids[0]}}},
+		{name: "Prefix", path: "/api/chirps/search?q=goph*&sort=recent", want: [][]uuid.UUID{{ids[2], ids[1], ids[0]}}},
+		{name: "Phrase", path: "/api/chirps/search?q=" + url.QueryEscape(`"generic types"`), want: [][]uuid.UUID{{ids[0]}}},
+		{name: "All words", path: "/api/chirps/search?q=types+said", want: [][]uuid.UUID{{ids[2]}}},
+		{name: "By author", path: "/api/chirps/search?q=generic&author_id=" + alice.Id.String(), want: [][]uuid.UUID{{ids[0], ids[2]}}},
+		{name: "No matches", path: "/api/chirps/search?q=rust", want: [][]uuid.UUID{nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := api.collectPages(t, tt.path, len(ids)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{name: "Missing query", query: "", field: "q"},
+		{name: "No words", query: "q=" + url.QueryEscape(`"*"`), field: "q"},
+		{name: "Query too long", query: "q=" + strings.Repeat("a", maxSearchQueryLength+1), field: "q"},
+		{name: "Unknown sort", query: "q=gopher&sort=oldest", field: "sort"},
+		{name: "Invalid cursor", query: "q=gopher&cursor=nope", field: "cursor"},
+		{name: "Invalid author", query: "q=gopher&author_id=nobody", field: "author_id"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.request("GET", "/api/chirps/search?"+tt.query, "", nil)
+			requireStatus(t, rec, http.StatusUnprocessableEntity)
+			if fields := fieldErrors(t, rec); fields[tt.field] == "" {
+				t.Errorf("fields = %v, want a %s error", fields, tt.field)
+			}
+		})
+	}
+}
+
+func TestChirpTags(t *testing.T) {
+	api := newTestAPI(t, "")
+	api.createUser("alice@example.com", "wonderland")
+	aliceToken := api.login("alice@example.com", "wonderland").Token
+
+	first := api.postChirp(aliceToken, "Learning #Go and #SQL")
+	second := api.postChirp(aliceToken, "More #go, #go, #go!")
+	third := api.postChirp(aliceToken, "No tags in a#b or #1")
+	if want := []string{"go", "sql"}; !slices.Equal(first.Tags, want) {
+		t.Errorf("tags = %q, want %q", first.Tags, want)
+	}
+	if len(third.Tags) != 0 {
+		t.Errorf("tags = %q, want none", third.Tags)
+	}
+
+	t.Run("Indexing fails", func(t *testing.T) {
+		db := api.cfg.db
+		api.cfg.db = failingTags{Store: db}
+		defer func() { api.cfg.db = db }()
+		rec := api.request("POST", "/api/chirps", bearer(aliceToken), map[string]string{"body": "Lost #chirp"})
+		requireStatus(t, rec, http.StatusInternalServerError)
+		chirps, err := db.ListChirps(context.Background(), database.ListChirpsParams{Limit: 10})
+		if err != nil || len(chirps) != 3 {
+			t.Errorf("ListChirps() = %d chirps, %v; want the 3 posted before", len(chirps), err)
+		}
+
+		rec = api.request("PUT", "/api/chirps/"+first.Id.String(), bearer(aliceToken), map[string]string{"body": "Unlearning #Go"})
+		requireStatus(t, rec, http.StatusInternalServerError)
+		if got, err := db.GetChirp(context.Background(), first.Id); err != nil || got.Body != first.Body {
+			t.Errorf("GetChirp() = %q, %v; want the body before the failed edit", got.Body, err)
+		}
+	})
+
+	wantTags := func(want ...string) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			if got := decode[Chirp](t, rec).Tags; !slices.Equal(got, want) {
+				t.Errorf("tags = %q, want %q", got, want)
+			}
+		}
+	}
+	wantTrending := func(want string) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			if got := strings.TrimSpace(rec.Body.String()); got != want {
+				t.Errorf("trending = %s, want %s", got, want)
+			}
+		}
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:       "Get tagged chirp",
+			method:     "GET",
+			path:       "/api/chirps/" + second.Id.String(),
+			wantStatus: http.StatusOK,
+			check:      wantTags("go"),
+		},
+		{
+			name:       "Trending",
+			method:     "GET",
+			path:       "/api/tags/trending",
+			wantStatus: http.StatusOK,
+			check:      wantTrending(`[{"tag":"go","chirp_count":2},{"tag":"sql","chirp_count":1}]`),
+		},
+		{
+			name:       "Trending limit",
+			method:     "GET",
+			path:       "/api/tags/trending?limit=1&window=1h",
+			wantStatus: http.StatusOK,
+			check:      wantTrending(`[{"tag":"go","chirp_count":2}]`),
+		},
+		{
+			name:       "Trending window too long",
+			method:     "GET",
+			path:       "/api/tags/trending?window=720h",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Trending window malformed",
+			method:     "GET",
+			path:       "/api/tags/trending?window=yesterday",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "Edit changes tags",
+			method:        "PUT",
+			path:          "/api/chirps/" + first.Id.String(),
+			authorization: bearer(aliceToken),
+			body:          map[string]string{"body": "Learning #Rust instead"},
+			wantStatus:    http.StatusOK,
+			check:         wantTags("rust"),
+		},
+		{
+			name:       "Invalid tag",
+			method:     "GET",
+			path:       "/api/tags/2024/chirps",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Unknown tag",
+			method:     "GET",
+			path:       "/api/tags/nothing/chirps",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if got := decode[[]Chirp](t, rec); len(got) != 0 {
+					t.Errorf("chirps = %+v, want none", got)
+				}
+			},
+		},
+	})
+
+	third = api.postChirp(aliceToken, "Back to #go")
+	tests := []struct {
+		name string
+		path string
+		want [][]uuid.UUID
+	}{
+		{name: "Newest first", path: "/api/tags/go/chirps", want: [][]uuid.UUID{{third.Id, second.Id}}},
+		{name: "With hash and case", path: "/api/tags/%23GO/chirps", want: [][]uuid.UUID{{third.Id, second.Id}}},
+		{name: "Pages", path: "/api/tags/go/chirps?limit=1", want: [][]uuid.UUID{{third.Id}, {second.Id}}},
+		{name: "Tag removed by edit", path: "/api/tags/sql/chirps", want: [][]uuid.UUID{nil}},
+		{name: "Tag added by edit", path: "/api/tags/rust/chirps", want: [][]uuid.UUID{{first.Id}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := api.collectPages(t, tt.path, 5); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// handleRace hides taken handles from GetUserByHandle, as if another request
+// took the handle between the check and the update.
+type handleRace struct {
+	store.Store
+}
+
+func (s handleRace) GetUserByHandle(ctx context.Context, handle string) (database.User, error) {
+	return database.User{}, sql.ErrNoRows
+}
+
+// failingTags fails to record hashtags, also in transactions.
+type failingTags struct {
+	store.Store
+}
+
+func (s failingTags) SetChirpTags(ctx context.Context, arg database.SetChirpTagsParams) error {
+	return errors.New("tags are unavailable")
+}
+
+func (s failingTags) InTx(ctx context.Context, fn func(store.Store) error) error {
+	return s.Store.InTx(ctx, func(tx store.Store) error {
+		return fn(failingTags{Store: tx})
+	})
+}
+
+func TestMentions(t *testing.T) {
+	api := newTestAPI(t, "")
+	api.createUser("alice@example.com", "wonderland")
+	aliceToken := api.login("alice@example.com", "wonderland").Token
+	api.createUser("bob@example.com", "builder")
+	bobToken := api.login("bob@example.com", "builder").Token
+
+	setHandle := func(token, email, password, handle string) *httptest.ResponseRecorder {
+		return api.request("PUT", "/api/users", bearer(token), map[string]string{
+			"email": email, "password": password, "handle": handle,
+		})
+	}
+	requireStatus(t, setHandle(aliceToken, "alice@example.com", "wonderland", "Alice"), http.StatusOK)
+	wantHandleTaken := func(t *testing.T, rec *httptest.ResponseRecorder) {
+		if code := problemCode(t, rec); code != "handle_taken" {
+			t.Errorf("code = %q", code)
+		}
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:          "Set handle",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(bobToken),
+			body:          map[string]string{"email": "bob@example.com", "password": "builder", "handle": "bob_b"},
+			wantStatus:    http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				if got := decode[User](t, rec).Handle; got == nil || *got != "bob_b" {
+					t.Errorf("handle = %v, want bob_b", got)
+				}
+			},
+		},
+		{
+			name:          "Invalid handle",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(bobToken),
+			body:          map[string]string{"email": "bob@example.com", "password": "builder", "handle": "b!"},
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "Handle taken in another case",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(bobToken),
+			body:          map[string]string{"email": "bob@example.com", "password": "builder", "handle": "ALICE"},
+			wantStatus:    http.StatusConflict,
+			check:         wantHandleTaken,
+		},
+		{
+			name:          "Keep own handle in another case",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(aliceToken),
+			body:          map[string]string{"email": "alice@example.com", "password": "wonderland", "handle": "alice"},
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:       "Mentions require authentication",
+			method:     "GET",
+			path:       "/api/users/me/mentions",
+			wantStatus: http.StatusUnauthorized,
+		},
+	})
+
+	t.Run("Handle taken concurrently", func(t *testing.T) {
+		db := api.cfg.db
+		api.cfg.db = handleRace{Store: db}
+		defer func() { api.cfg.db = db }()
+		rec := setHandle(bobToken, "bob@example.com", "builder", "alice")
+		requireStatus(t, rec, http.StatusConflict)
+		wantHandleTaken(t, rec)
+	})
+
+	first := api.postChirp(bobToken, "Hi @ALICE and @nobody, mail me at bob@example.com")
+	want := []Mention{{Handle: "ALICE", UserID: api.login("alice@example.com", "wonderland").Id, Start: 3, End: 9}}
+	if !reflect.DeepEqual(first.Mentions, want) {
+		t.Errorf("mentions = %+v, want %+v", first.Mentions, want)
+	}
+	second := api.postChirp(bobToken, "Ping @alice @alice")
+	if len(second.Mentions) != 2 {
+		t.Errorf("mentions = %+v, want two", second.Mentions)
+	}
+	third := api.postChirp(aliceToken, "Talking to myself, @alice")
+
+	mentions := func(path string) ([]uuid.UUID, string) {
+		t.Helper()
+		rec := api.request("GET", path, bearer(aliceToken), nil)
+		requireStatus(t, rec, http.StatusOK)
+		var ids []uuid.UUID
+		for _, chirp := range decode[[]Chirp](t, rec) {
+			ids = append(ids, chirp.Id)
+		}
+		return ids, rec.Header().Get("Link")
+	}
+	if got, _ := mentions("/api/users/me/mentions"); !slices.Equal(got, []uuid.UUID{third.Id, second.Id, first.Id}) {
+		t.Errorf("mentions = %v, want newest first", got)
+	}
+	got, link := mentions("/api/users/me/mentions?limit=2")
+	m := nextLinkRE.FindStringSubmatch(link)
+	if !slices.Equal(got, []uuid.UUID{third.Id, second.Id}) || m == nil {
+		t.Fatalf("first page = %v, Link = %q", got, link)
+	}
+	if got, link := mentions(m[1]); !slices.Equal(got, []uuid.UUID{first.Id}) || link != "" {
+		t.Errorf("second page = %v, Link = %q", got, link)
+	}
+
+	rec := api.request("PUT", "/api/chirps/"+second.Id.String(), bearer(bobToken), map[string]string{"body": "Never mind"})
+	requireStatus(t, rec, http.StatusOK)
+	if got := decode[Chirp](t, rec).Mentions; len(got) != 0 {
+		t.Errorf("mentions after edit = %+v, want none", got)
+	}
+	if got, _ := mentions("/api/users/me/mentions"); !slices.Equal(got, []uuid.UUID{third.Id, first.Id}) {
+		t.Errorf("mentions after edit = %v", got)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	api := newTestAPI(t, "")
+	alice := api.createUser("alice@example.com", "wonderland")
+	aliceToken := api.login("alice@example.com", "wonderland").Token
+	api.createUser("bob@example.com", "builder")
+	bobToken := api.login("bob@example.com", "builder").Token
+
+	update := func(fields map[string]any) map[string]any {
+		body := map[string]any{"email": "alice@example.com", "password": "wonderland"}
+		for k, v := range fields {
+			body[k] = v
+		}
+		return body
+	}
+	fieldError := func(field string) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			if _, ok := fieldErrors(t, rec)[field]; !ok {
+				t.Errorf("no error for %s in %s", field, rec.Body)
+			}
+		}
+	}
+
+	runAPITests(t, api, []apiTest{
+		{
+			name:          "Set profile",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(aliceToken),
+			body: update(map[string]any{
+				"handle":       "Alice",
+				"display_name": "Alice Liddell",
+				"bio":          "Curiouser and curiouser",
+				"website":      "https://example.com/alice",
+			}),
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				got := decode[User](t, rec)
+				if got.DisplayName != "Alice Liddell" || got.Bio != "Curiouser and curiouser" || got.AvatarURL != "" {
+					t.Errorf("user = %+v", got)
+				}
+			},
+		},
+		{
+			name:          "Omitted fields are kept",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(aliceToken),
+			body:          update(map[string]any{"avatar_url": "http://example.com/alice.png"}),
+			wantStatus:    http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder) {
+				got := decode[User](t, rec)
+				if got.DisplayName != "Alice Liddell" || got.AvatarURL != "http://example.com/alice.png" {
+					t.Errorf("user = %+v", got)
+				}
+			},
+		},
+		{
+			name:          "Display name too long",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(aliceToken),
+			body:          update(map[string]any{"display_name": strings.Repeat("a", maxDisplayNameLength+1)}),
+			wantStatus:    http.StatusUnprocessableEntity,
+			check:         fieldError("display_name"),
+		},
+		{
+			name:          "Bio too long",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(aliceToken),
+			body:          update(map[string]any{"bio": strings.Repeat("a", maxBioLength+1)}),
+			wantStatus:    http.StatusUnprocessableEntity,
+			check:         fieldError("bio"),
+		},
+		{
+			name:          "Website not http",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(aliceToken),
+			body:          update(map[string]any{"website": "javascript:alert(1)"}),
+			wantStatus:    http.StatusUnprocessableEntity,
+			check:         fieldError("website"),
+		},
+		{
+			name:          "Avatar URL relative",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(aliceToken),
+			body:          update(map[string]any{"avatar_url": "/alice.png"}),
+			wantStatus:    http.StatusUnprocessableEntity,
+			check:         fieldError("avatar_url"),
+		},
+		{
+			name:          "Handle me is too short",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(bobToken),
+			body:          map[string]string{"email": "bob@example.com", "password": "builder", "handle": "me"},
+			wantStatus:    http.StatusUnprocessableEntity,
+			check:         fieldError("handle"),
+		},
+		{
+			name:       "Unknown handle",
+			method:     "GET",
+			path:       "/api/users/nobody",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Invalid handle",
+			method:     "GET",
+			path:       "/api/users/a!",
+			wantStatus: http.StatusNotFound,
+		},
+	})
+
+	api.postChirp(aliceToken, "Down the rabbit hole")
+	bobChirp := api.postChirp(bobToken, "Can we fix it?")
+	api.postChirp(aliceToken, "Drink me")
+
+	rec := api.request("GET", "/api/users/ALICE", "", nil)
+	requireStatus(t, rec, http.StatusOK)
+	if strings.Contains(rec.Body.String(), "alice@example.com") || strings.Contains(rec.Body.String(), `"email"`) {
+		t.Errorf("profile exposes the email: %s", rec.Body)
+	}
+	want := Profile{
+		Id:          alice.Id,
+		Handle:      "Alice",
+		DisplayName: "Alice Liddell",
+		Bio:         "Curiouser and curiouser",
+		Website:     "https://example.com/alice",
+		AvatarURL:   "http://example.com/alice.png",
+		CreatedAt:   alice.CreatedAt,
+		ChirpCount:  2,
+	}
+	if got := decode[Profile](t, rec); !reflect.DeepEqual(got, want) {
+		t.Errorf("profile = %+v, want %+v", got, want)
+	}
+
+	rec = api.request("GET", "/api/chirps", "", nil)
+	requireStatus(t, rec, http.StatusOK)
+	for _, chirp := range decode[[]Chirp](t, rec) {
+		if chirp.Id == bobChirp.Id {
+			if chirp.AuthorHandle != nil {
+				t.Errorf("author_handle = %q, want null for a user without a handle", *chirp.AuthorHandle)
+			}
+		} else if chirp.AuthorHandle == nil || *chirp.AuthorHandle != "Alice" {
+			t.Errorf("author_handle = %v, want Alice", chirp.AuthorHandle)
+		}
+	}
+
+	wantFollowers := func(want int64) func(t *testing.T, rec *httptest.ResponseRecorder) {
+		return func(t *testing.T, rec *httptest.ResponseRecorder) {
+			if got := decode[Profile](t, rec); got.Id != alice.Id || got.FollowerCount != want {
+				t.Errorf("profile = %+v, want alice with %d followers", got, want)
+			}
+		}
+	}
+	runAPITests(t, api, []apiTest{
+		{
+			name:       "Follow without token",
+			method:     "POST",
+			path:       "/api/users/alice/followers",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Follow",
+			method:        "POST",
+			path:          "/api/users/alice/followers",
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantFollowers(1),
+		},
+		{
+			name:          "Follow again",
+			method:        "POST",
+			path:          "/api/users/ALICE/followers",
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantFollowers(1),
+		},
+		{
+			name:          "Follow oneself",
+			method:        "POST",
+			path:          "/api/users/alice/followers",
+			authorization: bearer(aliceToken),
+			wantStatus:    http.StatusUnprocessableEntity,
+			check:         fieldError("handle"),
+		},
+		{
+			name:          "Follow unknown user",
+			method:        "POST",
+			path:          "/api/users/nobody/followers",
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:       "Profile counts followers",
+			method:     "GET",
+			path:       "/api/users/alice",
+			wantStatus: http.StatusOK,
+			check:      wantFollowers(1),
+		},
+		{
+			name:          "Unfollow",
+			method:        "DELETE",
+			path:          "/api/users/alice/followers",
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantFollowers(0),
+		},
+		{
+			name:          "Unfollow again",
+			method:        "DELETE",
+			path:          "/api/users/alice/followers",
+			authorization: bearer(bobToken),
+			wantStatus:    http.StatusOK,
+			check:         wantFollowers(0),
+		},
+	})
+}
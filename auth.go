@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/jakubbortlik/chirpy/internal/auth"
+)
+
+// authRequirement declares how a route authenticates its callers.
+type authRequirement int
+
+const (
+	// authNone routes do not look at the Authorization header, either
+	// because they are public or because they check credentials other than
+	// an access token themselves.
+	authNone authRequirement = iota
+	// authOptional routes serve anonymous callers, but reject invalid
+	// access tokens and make the user of valid ones available.
+	authOptional
+	// authRequired routes reject callers without a valid access token.
+	authRequired
+	// authAdmin routes additionally require the caller to be an admin.
+	authAdmin
+)
+
+// middlewareAuth validates the bearer access token as required by req and
+// stores the authenticated user in the request context, where handlers get
+// it with auth.UserID.
+func (cfg *apiConfig) middlewareAuth(req authRequirement, next http.Handler) http.Handler {
+	if req == authNone {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			if req == authOptional && r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			respondWithError(w, r, tokenProblem(err), "", err)
+			return
+		}
+		userID, err := auth.ValidateJWT(token, cfg.JWTSecret)
+		if err != nil {
+			respondWithError(w, r, tokenProblem(err), "", err)
+			return
+		}
+		setRequestUser(r, userID)
+		principal := auth.Principal{UserID: userID}
+
+		if req == authAdmin {
+			user, err := cfg.db.GetUserByID(r.Context(), userID)
+			if err != nil {
+				respondWithError(w, r, storeProblem(err, errInvalidToken), "", err)
+				return
+			}
+			if !user.IsAdmin {
+				respondWithError(w, r, errForbiddenNotAdmin, "", nil)
+				return
+			}
+			principal.IsAdmin = true
+		}
+
+		ctx := auth.NewContext(r.Context(), principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// chirpCursor identifies the last chirp of a page of chirps; the next page
+// starts right after it in the requested sort order. Clients get it encoded
+// and must treat it as opaque.
+type chirpCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// before reports whether c sorts before d in (created_at, id) order.
+func (c chirpCursor) before(d chirpCursor) bool {
+	if !c.CreatedAt.Equal(d.CreatedAt) {
+		return c.CreatedAt.Before(d.CreatedAt)
+	}
+	return bytes.Compare(c.ID[:], d.ID[:]) < 0
+}
+
+func (c chirpCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.raw()))
+}
+
+func (c chirpCursor) raw() string {
+	return fmt.Sprintf("%d.%s", c.CreatedAt.UnixMicro(), c.ID)
+}
+
+func parseChirpCursor(s string) (chirpCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return chirpCursor{}, errInvalidCursor
+	}
+	return parseRawChirpCursor(string(raw))
+}
+
+func parseRawChirpCursor(raw string) (chirpCursor, error) {
+	micros, id, ok := strings.Cut(raw, ".")
+	if !ok {
+		return chirpCursor{}, errInvalidCursor
+	}
+	us, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return chirpCursor{}, errInvalidCursor
+	}
+	chirpID, err := uuid.Parse(id)
+	if err != nil {
+		return chirpCursor{}, errInvalidCursor
+	}
+	return chirpCursor{CreatedAt: time.UnixMicro(us).UTC(), ID: chirpID}, nil
+}
+
+// searchCursor is a chirpCursor for search results ordered by relevance,
+// which also needs the rank of the last result. The rank is encoded by its
+// bits so that it survives the round trip exactly.
+type searchCursor struct {
+	Rank float32
+	chirpCursor
+}
+
+func (c searchCursor) String() string {
+	raw := strconv.FormatUint(uint64(math.Float32bits(c.Rank)), 16) + "." + c.chirpCursor.raw()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parseSearchCursor(s string) (searchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return searchCursor{}, errInvalidCursor
+	}
+	bits, rest, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return searchCursor{}, errInvalidCursor
+	}
+	rank, err := strconv.ParseUint(bits, 16, 32)
+	if err != nil {
+		return searchCursor{}, errInvalidCursor
+	}
+	c, err := parseRawChirpCursor(rest)
+	if err != nil {
+		return searchCursor{}, err
+	}
+	return searchCursor{Rank: math.Float32frombits(uint32(rank)), chirpCursor: c}, nil
+}
+
+// setNextLink sets a Link header pointing at the same request with the
+// cursor query parameter replaced, as described in RFC 8288.
+func setNextLink(w http.ResponseWriter, r *http.Request, cursor string) {
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
+}
+
+// threadCursor is the path of the last reply on a page of a thread, as
+// returned by GetChirpDescendants.
+type threadCursor []string
+
+func (c threadCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(c, ",")))
+}
+
+func parseThreadCursor(s string) (threadCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(raw) == 0 {
+		return nil, errInvalidCursor
+	}
+	path := strings.Split(string(raw), ",")
+	if slices.Contains(path, "") {
+		return nil, errInvalidCursor
+	}
+	return path, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jakubbortlik/chirpy/internal/config"
+)
+
+// openDB opens the connection pool shared by all handlers and pings the
+// database so that a bad DB_URL fails at startup rather than on the first
+// request.
+func openDB(ctx context.Context, conf config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", conf.DBURL)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	db.SetMaxOpenConns(conf.DBMaxOpenConns)
+	db.SetMaxIdleConns(conf.DBMaxIdleConns)
+	db.SetConnMaxLifetime(conf.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(conf.DBConnMaxIdleTime)
+
+	pingCtx, cancel := context.WithTimeout(ctx, conf.DBPingTimeout)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("pinging database: %w", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+)
+
+// threadReply is a reply in a thread together with the replies to it.
+type threadReply struct {
+	Chirp
+	Replies []*threadReply `json:"replies"`
+}
+
+// handlerGetChirpThread returns the thread around a chirp: the chain of
+// chirps it replies to, starting at the top of the thread, and the replies
+// below it as a tree. The replies are paginated like handlerGetChirps, a
+// limit of replies at any depth per page. A page can start in the middle of
+// a subtree; such replies are listed at the top level and their in_reply_to
+// says where they belong.
+func (cfg *apiConfig) handlerGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Ancestors []Chirp        `json:"ancestors"`
+		Chirp     Chirp          `json:"chirp"`
+		Replies   []*threadReply `json:"replies"`
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, errInvalidID, "Invalid chirp ID", err)
+		return
+	}
+	var v validate.Validator
+	limit := queryInt(&v, r, "limit", defaultChirpPageSize, 1, maxChirpPageSize)
+	var cursor threadCursor
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		cursor, err = parseThreadCursor(c)
+		v.Check(err == nil, "cursor", "must be a cursor from a previous response")
+	}
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, r, storeProblem(err, errChirpNotFound), "", err)
+		return
+	}
+	ancestors, err := cfg.db.GetChirpAncestors(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, r, errInternal, "Getting thread failed", err)
+		return
+	}
+	rows, err := cfg.db.GetChirpDescendants(r.Context(), database.GetChirpDescendantsParams{
+		ID:        chirpID,
+		AfterPath: cursor,
+		Limit:     int32(limit) + 1,
+	})
+	if err != nil {
+		respondWithError(w, r, errInternal, "Getting thread failed", err)
+		return
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		setNextLink(w, r, threadCursor(rows[limit-1].Path).String())
+	}
+
+	resp := response{
+		Ancestors: make([]Chirp, 0, len(ancestors)),
+		Chirp:     newChirp(chirp),
+		Replies:   []*threadReply{},
+	}
+	for _, ancestor := range ancestors {
+		resp.Ancestors = append(resp.Ancestors, newChirp(ancestor))
+	}
+
+	// Rows come in thread order, so the parent of a reply, if it is on this
+	// page, is the closest shallower reply before it.
+	type open struct {
+		reply *threadReply
+		depth int32
+	}
+	var stack []open
+	chirps := []*Chirp{&resp.Chirp}
+	for i := range resp.Ancestors {
+		chirps = append(chirps, &resp.Ancestors[i])
+	}
+	for _, row := range rows {
+		reply := &threadReply{
+			Chirp:   newChirp(row.Chirp),
+			Replies: []*threadReply{},
+		}
+		for len(stack) > 0 && stack[len(stack)-1].depth >= row.Depth {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 && stack[len(stack)-1].reply.Id == row.Chirp.ParentID.UUID {
+			parent := stack[len(stack)-1].reply
+			parent.Replies = append(parent.Replies, reply)
+		} else {
+			resp.Replies = append(resp.Replies, reply)
+		}
+		stack = append(stack, open{reply: reply, depth: row.Depth})
+		chirps = append(chirps, &reply.Chirp)
+	}
+	if err := cfg.completeChirps(r.Context(), chirps...); err != nil {
+		respondWithError(w, r, errInternal, "Getting thread failed", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -1,15 +1,15 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/json"
+	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jakubbortlik/chirpy/internal/auth"
 	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/store"
+	"github.com/jakubbortlik/chirpy/internal/validate"
 )
 
 type User struct {
@@ -18,9 +18,34 @@ type User struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 	Email       *string   `json:"email"`
 	IsChirpyRed bool      `json:"is_chirpy_red"`
+	Handle      *string   `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	Website     string    `json:"website"`
+	AvatarURL   string    `json:"avatar_url"`
 }
 
-func handlerCreateUser(w http.ResponseWriter, r *http.Request) {
+// newUser converts a user from the database for responses to the user
+// themselves or to admins.
+func newUser(user database.User) User {
+	u := User{
+		Id:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       &user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Website:     user.Website,
+		AvatarURL:   user.AvatarUrl,
+	}
+	if user.Handle.Valid {
+		u.Handle = &user.Handle.String
+	}
+	return u
+}
+
+func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Email    *string `json:"email"`
 		Password *string `json:"password"`
@@ -29,46 +54,55 @@ func handlerCreateUser(w http.ResponseWriter, r *http.Request) {
 		User
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Decoding parameters failed", err)
+	if !decodeJSON(w, r, &params) {
 		return
 	}
-
-	hashedPassword, err := auth.HashPassword(*params.Password)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
+	var v validate.Validator
+	validateEmail(&v, params.Email)
+	validatePassword(&v, params.Password)
+	if respondWithInvalid(w, r, &v) {
 		return
 	}
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+	hashedPassword, err := auth.HashPassword(*params.Password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Connecting to database failed", err)
+		respondWithError(w, r, errInternal, "Hashing password failed", err)
 		return
 	}
 
-	dbQueries := database.New(db)
 	createUserParams := database.CreateUserParams{
 		Email:          *params.Email,
 		HashedPassword: hashedPassword,
 	}
-	user, err := dbQueries.CreateUser(r.Context(), createUserParams)
+	user, err := cfg.db.CreateUser(r.Context(), createUserParams)
 
+	if store.IsUniqueViolation(err, store.UsersEmailKey) {
+		respondWithError(w, r, errEmailTaken, "", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Creating user failed", err)
+		respondWithError(w, r, errInternal, "Creating user failed", err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusCreated, response{
-		User: User{
-			Id:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       &user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User: newUser(user),
 	})
 }
+
+// maxPasswordBytes is the longest password bcrypt accepts.
+const maxPasswordBytes = 72
+
+func validateEmail(v *validate.Validator, email *string) {
+	v.Required("email", email)
+	v.Email("email", email)
+	v.Length("email", email, 3, 254)
+}
+
+func validatePassword(v *validate.Validator, password *string) {
+	v.Required("password", password)
+	if password != nil {
+		v.Check(len(*password) <= maxPasswordBytes, "password", fmt.Sprintf("must be at most %d bytes long", maxPasswordBytes))
+	}
+}
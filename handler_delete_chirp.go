@@ -1,58 +1,35 @@
 package main
 
 import (
-	"database/sql"
 	"net/http"
-	"os"
 
 	"github.com/google/uuid"
 	"github.com/jakubbortlik/chirpy/internal/auth"
-	"github.com/jakubbortlik/chirpy/internal/database"
 )
 
-func handlerDeleteChirp(w http.ResponseWriter, r *http.Request, apiConfig *apiConfig) {
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "No token in header", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, apiConfig.JWTSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token invalid", err)
-		return
-	}
+func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserID(r.Context())
 
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
-
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Decoding parameters failed", err)
-		return
-	}
-
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
-	dbQueries := database.New(db)
-
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Parsing chirpID failed.", err)
+		respondWithError(w, r, errInvalidID, "Invalid chirp ID", err)
 		return
 	}
 
-	chirp, err := dbQueries.GetChirp(r.Context(), chirpID)
+	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Chirp not found.", err)
+		respondWithError(w, r, storeProblem(err, errChirpNotFound), "", err)
 		return
 	}
 
 	if chirp.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "Not allowed to delete chirp.", err)
+		respondWithError(w, r, errForbiddenNotOwner, "Only the author can delete a chirp", nil)
 		return
 	}
 
-	err = dbQueries.DeleteChirp(r.Context(), chirpID)
+	err = cfg.db.DeleteChirp(r.Context(), chirpID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Chirp not found.", err)
+		respondWithError(w, r, errInternal, "Deleting chirp failed", err)
 		return
 	}
 
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/jakubbortlik/chirpy/internal/auth"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+)
+
+// handlerFollowUser makes the authenticated user follow the user with the
+// {handle} path wildcard. Following a user twice is the same as following
+// them once. It responds with their profile and its new follower count.
+func (cfg *apiConfig) handlerFollowUser(w http.ResponseWriter, r *http.Request) {
+	cfg.setFollow(w, r, true)
+}
+
+// handlerUnfollowUser stops following a user, if the authenticated user did,
+// and responds like handlerFollowUser.
+func (cfg *apiConfig) handlerUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	cfg.setFollow(w, r, false)
+}
+
+func (cfg *apiConfig) setFollow(w http.ResponseWriter, r *http.Request, follow bool) {
+	userID, _ := auth.UserID(r.Context())
+
+	user, ok := cfg.userByHandle(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	if follow {
+		var v validate.Validator
+		v.Check(user.ID != userID, "handle", "cannot be your own")
+		if respondWithInvalid(w, r, &v) {
+			return
+		}
+		err = cfg.db.FollowUser(r.Context(), database.FollowUserParams{FollowerID: userID, FolloweeID: user.ID})
+	} else {
+		err = cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{FollowerID: userID, FolloweeID: user.ID})
+	}
+	if err != nil {
+		respondWithError(w, r, errInternal, "Updating follow failed", err)
+		return
+	}
+
+	cfg.respondWithProfile(w, r, user)
+}
@@ -2,78 +2,128 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
-	"os"
 
 	"github.com/google/uuid"
 	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/validate"
 )
 
-func handlerGetChirps(w http.ResponseWriter, r *http.Request) {
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Opening database connection failed.", err)
-		return
-	}
+const (
+	defaultChirpPageSize = 50
+	maxChirpPageSize     = 100
+)
 
-	filterUserID := uuid.NullUUID{
-		UUID: uuid.Nil,
+// handlerGetChirps lists chirps a page at a time, oldest first unless
+// sort=desc. The results can be narrowed to some authors (author_id, which
+// may be repeated or comma-separated), to a since/until time window, and to
+// chirps newer than since_id. When there are more chirps, the response has a
+// Link header with rel="next" whose URL carries an opaque cursor for the next
+// page.
+func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var v validate.Validator
+	limit := queryInt(&v, r, "limit", defaultChirpPageSize, 1, maxChirpPageSize)
+	sort := query.Get("sort")
+	v.Check(sort == "" || sort == "asc" || sort == "desc", "sort", "must be asc or desc")
+	params := database.ListChirpsParams{
+		AuthorIds: queryUUIDs(&v, r, "author_id"),
+		Since:     queryTime(&v, r, "since"),
+		Until:     queryTime(&v, r, "until"),
+		Limit:     int32(limit) + 1,
+	}
+	if params.Since.Valid && params.Until.Valid {
+		v.Check(params.Since.Time.Before(params.Until.Time), "until", "must be after since")
+	}
+	var cursor *chirpCursor
+	if c := query.Get("cursor"); c != "" {
+		parsed, err := parseChirpCursor(c)
+		v.Check(err == nil, "cursor", "must be a cursor from a previous response")
+		cursor = &parsed
+	}
+	var sinceID uuid.UUID
+	if s := query.Get("since_id"); s != "" {
+		id, err := uuid.Parse(s)
+		v.Check(err == nil, "since_id", "must be a valid UUID")
+		sinceID = id
+	}
+	if respondWithInvalid(w, r, &v) {
+		return
 	}
 
-	if authorID := r.URL.Query().Get("author_id"); authorID != "" {
-		userID, err := uuid.Parse(authorID)
+	// since_id is an exclusive lower bound in either order; the cursor is a
+	// lower bound when ascending and an upper bound when descending.
+	var after *chirpCursor
+	if sinceID != uuid.Nil {
+		since, err := cfg.db.GetChirp(r.Context(), sinceID)
+		if errors.Is(err, sql.ErrNoRows) {
+			v.Check(false, "since_id", "must be the ID of an existing chirp")
+			respondWithInvalid(w, r, &v)
+			return
+		}
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Parsing author_id failed.", err)
+			respondWithError(w, r, errInternal, "Getting chirps failed", err)
 			return
 		}
-		filterUserID.UUID = userID
+		after = &chirpCursor{CreatedAt: since.CreatedAt, ID: since.ID}
+	}
+	if cursor != nil && sort != "desc" && (after == nil || after.before(*cursor)) {
+		after = cursor
+	}
+	if after != nil {
+		params.AfterCreatedAt = sql.NullTime{Time: after.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: after.ID, Valid: true}
 	}
 
-	dbQueries := database.New(db)
-	chirps_data, err := dbQueries.GetChirps(r.Context(), filterUserID.UUID)
+	var chirps_data []database.Chirp
+	var err error
+	if sort == "desc" {
+		if cursor != nil {
+			params.BeforeCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+			params.BeforeID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+		}
+		chirps_data, err = cfg.db.ListChirpsDesc(r.Context(), database.ListChirpsDescParams(params))
+	} else {
+		chirps_data, err = cfg.db.ListChirps(r.Context(), params)
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Getting chirps from database failed.", err)
+		respondWithError(w, r, errInternal, "Getting chirps failed", err)
 		return
 	}
-	var chirps []Chirp
+	if len(chirps_data) > limit {
+		chirps_data = chirps_data[:limit]
+		last := chirps_data[limit-1]
+		setNextLink(w, r, chirpCursor{CreatedAt: last.CreatedAt, ID: last.ID}.String())
+	}
+
+	chirps := make([]Chirp, 0, len(chirps_data))
 	for _, chirp := range chirps_data {
-		chirps = append(chirps, Chirp{
-			Id:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-		})
+		chirps = append(chirps, newChirp(chirp))
+	}
+	if err := cfg.completeChirpsAll(r.Context(), chirps); err != nil {
+		respondWithError(w, r, errInternal, "Getting chirps failed", err)
+		return
 	}
 
 	respondWithJSON(w, http.StatusOK, chirps)
 }
 
-func handlerGetIndividualChirp(w http.ResponseWriter, r *http.Request) {
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Opening database connection failed.", err)
-		return
-	}
-	dbQueries := database.New(db)
+func (cfg *apiConfig) handlerGetIndividualChirp(w http.ResponseWriter, r *http.Request) {
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Parsing chirpID failed.", err)
+		respondWithError(w, r, errInvalidID, "Invalid chirp ID", err)
 		return
 	}
-	chirp_data, err := dbQueries.GetChirp(r.Context(), chirpID)
+	chirp_data, err := cfg.db.GetChirp(r.Context(), chirpID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Getting chirps from database failed.", err)
+		respondWithError(w, r, storeProblem(err, errChirpNotFound), "", err)
 		return
 	}
-	chirp := Chirp{
-		Id:        chirp_data.ID,
-		CreatedAt: chirp_data.CreatedAt,
-		UpdatedAt: chirp_data.UpdatedAt,
-		Body:      chirp_data.Body,
-		UserID:    chirp_data.UserID,
+	chirp := newChirp(chirp_data)
+	if err := cfg.completeChirps(r.Context(), &chirp); err != nil {
+		respondWithError(w, r, errInternal, "Getting chirp failed", err)
+		return
 	}
 
 	respondWithJSON(w, http.StatusOK, chirp)
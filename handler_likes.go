@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/auth"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+)
+
+// setLikedByMe fills in liked_by_me on chirps for the authenticated user,
+// with one query however many chirps there are. Anonymous requests leave
+// it out.
+func (cfg *apiConfig) setLikedByMe(ctx context.Context, chirps ...*Chirp) error {
+	userID, ok := auth.UserID(ctx)
+	if !ok || len(chirps) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.Id)
+	}
+	liked, err := cfg.db.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{
+		UserID:   userID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+	for _, chirp := range chirps {
+		likedByMe := slices.Contains(liked, chirp.Id)
+		chirp.LikedByMe = &likedByMe
+	}
+	return nil
+}
+
+// handlerLikeChirp likes a chirp for the authenticated user. Liking a chirp
+// twice is the same as liking it once. It responds with the chirp and its
+// new like count.
+func (cfg *apiConfig) handlerLikeChirp(w http.ResponseWriter, r *http.Request) {
+	cfg.setLike(w, r, true)
+}
+
+// handlerUnlikeChirp takes back a like, if there was one, and responds like
+// handlerLikeChirp.
+func (cfg *apiConfig) handlerUnlikeChirp(w http.ResponseWriter, r *http.Request) {
+	cfg.setLike(w, r, false)
+}
+
+func (cfg *apiConfig) setLike(w http.ResponseWriter, r *http.Request, like bool) {
+	userID, _ := auth.UserID(r.Context())
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, errInvalidID, "Invalid chirp ID", err)
+		return
+	}
+	if _, err := cfg.db.GetChirp(r.Context(), chirpID); err != nil {
+		respondWithError(w, r, storeProblem(err, errChirpNotFound), "", err)
+		return
+	}
+
+	if like {
+		err = cfg.db.LikeChirp(r.Context(), database.LikeChirpParams{ChirpID: chirpID, UserID: userID})
+	} else {
+		err = cfg.db.UnlikeChirp(r.Context(), database.UnlikeChirpParams{ChirpID: chirpID, UserID: userID})
+	}
+	if err != nil {
+		respondWithError(w, r, errInternal, "Updating like failed", err)
+		return
+	}
+
+	chirp_data, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, r, storeProblem(err, errChirpNotFound), "", err)
+		return
+	}
+	chirp := newChirp(chirp_data)
+	if err := cfg.completeChirps(r.Context(), &chirp); err != nil {
+		respondWithError(w, r, errInternal, "Getting chirp failed", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirp)
+}
+
+// handlerGetUserLikes lists the chirps a user likes, most recently liked
+// first, paginated like handlerGetChirps.
+func (cfg *apiConfig) handlerGetUserLikes(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, errInvalidID, "Invalid user ID", err)
+		return
+	}
+	var v validate.Validator
+	limit := queryInt(&v, r, "limit", defaultChirpPageSize, 1, maxChirpPageSize)
+	params := database.ListLikedChirpsParams{UserID: userID, Limit: int32(limit) + 1}
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		cursor, err := parseChirpCursor(c)
+		v.Check(err == nil, "cursor", "must be a cursor from a previous response")
+		params.BeforeLikedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: err == nil}
+		params.BeforeID = uuid.NullUUID{UUID: cursor.ID, Valid: err == nil}
+	}
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	if _, err := cfg.db.GetUserByID(r.Context(), userID); err != nil {
+		respondWithError(w, r, storeProblem(err, errUserNotFound), "", err)
+		return
+	}
+	rows, err := cfg.db.ListLikedChirps(r.Context(), params)
+	if err != nil {
+		respondWithError(w, r, errInternal, "Getting likes failed", err)
+		return
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		setNextLink(w, r, chirpCursor{CreatedAt: last.LikedAt, ID: last.Chirp.ID}.String())
+	}
+
+	chirps := make([]Chirp, 0, len(rows))
+	for _, row := range rows {
+		chirps = append(chirps, newChirp(row.Chirp))
+	}
+	if err := cfg.completeChirpsAll(r.Context(), chirps); err != nil {
+		respondWithError(w, r, errInternal, "Getting likes failed", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
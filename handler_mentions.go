@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/auth"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/entities"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+)
+
+// Mention is an @handle in a chirp body that was resolved to a user when
+// the chirp was posted or last edited. Start and End are offsets in
+// characters of the whole mention, @ included; End is exclusive.
+type Mention struct {
+	Handle string    `json:"handle"`
+	UserID uuid.UUID `json:"user_id"`
+	Start  int       `json:"start"`
+	End    int       `json:"end"`
+}
+
+// setMentions fills in the mentions of chirps with one query however many
+// chirps there are. Handles in a body that did not belong to anyone when it
+// was written are left out.
+func (cfg *apiConfig) setMentions(ctx context.Context, chirps ...*Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.Id)
+	}
+	rows, err := cfg.db.GetChirpMentions(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, chirp := range chirps {
+		chirp.Mentions = []Mention{}
+		for _, m := range entities.Mentions(chirp.Body) {
+			for _, row := range rows {
+				if row.ChirpID == chirp.Id && strings.EqualFold(row.Handle, m.Handle) {
+					chirp.Mentions = append(chirp.Mentions, Mention{
+						Handle: m.Handle,
+						UserID: row.UserID,
+						Start:  m.Start,
+						End:    m.End,
+					})
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mentionedHandles returns the handles body mentions, lower-cased and
+// without duplicates, as SetChirpMentions takes them.
+func mentionedHandles(body string) []string {
+	var handles []string
+	for _, m := range entities.Mentions(body) {
+		handle := strings.ToLower(m.Handle)
+		if !slices.Contains(handles, handle) {
+			handles = append(handles, handle)
+		}
+	}
+	return handles
+}
+
+// handlerGetMentions lists the chirps that mention the authenticated user,
+// newest first, paginated like handlerGetChirps.
+func (cfg *apiConfig) handlerGetMentions(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserID(r.Context())
+
+	var v validate.Validator
+	limit := queryInt(&v, r, "limit", defaultChirpPageSize, 1, maxChirpPageSize)
+	params := database.ListMentionsParams{UserID: userID, Limit: int32(limit) + 1}
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		cursor, err := parseChirpCursor(c)
+		v.Check(err == nil, "cursor", "must be a cursor from a previous response")
+		params.BeforeCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: err == nil}
+		params.BeforeID = uuid.NullUUID{UUID: cursor.ID, Valid: err == nil}
+	}
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	chirps_data, err := cfg.db.ListMentions(r.Context(), params)
+	if err != nil {
+		respondWithError(w, r, errInternal, "Getting mentions failed", err)
+		return
+	}
+	if len(chirps_data) > limit {
+		chirps_data = chirps_data[:limit]
+		last := chirps_data[limit-1]
+		setNextLink(w, r, chirpCursor{CreatedAt: last.CreatedAt, ID: last.ID}.String())
+	}
+
+	chirps := make([]Chirp, 0, len(chirps_data))
+	for _, chirp := range chirps_data {
+		chirps = append(chirps, newChirp(chirp))
+	}
+	if err := cfg.completeChirpsAll(r.Context(), chirps); err != nil {
+		respondWithError(w, r, errInternal, "Getting mentions failed", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
@@ -1,17 +1,20 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jakubbortlik/chirpy/internal/auth"
 	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/entities"
+	"github.com/jakubbortlik/chirpy/internal/store"
+	"github.com/jakubbortlik/chirpy/internal/validate"
 )
 
 type Chirp struct {
@@ -20,81 +23,302 @@ type Chirp struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Body      string    `json:"body"`
 	UserID    uuid.UUID `json:"user_id"`
+	Edited    bool      `json:"edited"`
+
+	AuthorHandle *string `json:"author_handle"`
+
+	InReplyTo     *uuid.UUID `json:"in_reply_to"`
+	ParentDeleted bool       `json:"parent_deleted"`
+	ReplyCount    int32      `json:"reply_count"`
+
+	LikeCount int32 `json:"like_count"`
+	LikedByMe *bool `json:"liked_by_me,omitempty"`
+
+	RechirpOf    *uuid.UUID `json:"rechirp_of"`
+	QuoteOf      *uuid.UUID `json:"quote_of"`
+	QuoteDeleted bool       `json:"quote_deleted"`
+	RechirpCount int32      `json:"rechirp_count"`
+	QuoteCount   int32      `json:"quote_count"`
+	Original     *Chirp     `json:"original,omitempty"`
+
+	Tags     []string  `json:"tags"`
+	Mentions []Mention `json:"mentions"`
+}
+
+// newChirp converts a chirp from the database for responses. A chirp is
+// edited once its body has been changed after it was posted. A reply whose
+// parent has been deleted has no in_reply_to but parent_deleted set, and
+// likewise a quote whose quoted chirp has been deleted has quote_deleted.
+func newChirp(chirp database.Chirp) Chirp {
+	c := Chirp{
+		Id:            chirp.ID,
+		CreatedAt:     chirp.CreatedAt,
+		UpdatedAt:     chirp.UpdatedAt,
+		Body:          chirp.Body,
+		UserID:        chirp.UserID,
+		Edited:        chirp.UpdatedAt.After(chirp.CreatedAt),
+		ParentDeleted: chirp.IsReply && !chirp.ParentID.Valid,
+		ReplyCount:    chirp.ReplyCount,
+		LikeCount:     chirp.LikeCount,
+		QuoteDeleted:  chirp.IsQuote && !chirp.QuoteOf.Valid,
+		RechirpCount:  chirp.RechirpCount,
+		QuoteCount:    chirp.QuoteCount,
+		Tags:          []string{},
+		Mentions:      []Mention{},
+	}
+	if chirp.ParentID.Valid {
+		c.InReplyTo = &chirp.ParentID.UUID
+	}
+	if chirp.RechirpOf.Valid {
+		c.RechirpOf = &chirp.RechirpOf.UUID
+	}
+	if chirp.QuoteOf.Valid {
+		c.QuoteOf = &chirp.QuoteOf.UUID
+	}
+	return c
+}
+
+// originalID returns the chirp a rechirp or a quote shares.
+func (c *Chirp) originalID() (uuid.UUID, bool) {
+	switch {
+	case c.RechirpOf != nil:
+		return *c.RechirpOf, true
+	case c.QuoteOf != nil:
+		return *c.QuoteOf, true
+	}
+	return uuid.Nil, false
+}
+
+// completeChirps fills in what responses show about chirps besides their
+// own columns: the chirp a rechirp or a quote shares, inline as original,
+// and the author handle, tags, mentions and liked_by_me of all of them. It
+// takes five queries however many chirps there are. Originals are not
+// completed in turn, so a quote of a quote shows the chirp it quotes but not
+// the one that one quotes.
+func (cfg *apiConfig) completeChirps(ctx context.Context, chirps ...*Chirp) error {
+	var ids []uuid.UUID
+	for _, chirp := range chirps {
+		if id, ok := chirp.originalID(); ok && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	all := slices.Clip(chirps)
+	if len(ids) > 0 {
+		originals, err := cfg.db.GetChirpsByIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, chirp := range chirps {
+			id, _ := chirp.originalID()
+			i := slices.IndexFunc(originals, func(original database.Chirp) bool { return original.ID == id })
+			if i < 0 {
+				continue
+			}
+			original := newChirp(originals[i])
+			chirp.Original = &original
+			all = append(all, chirp.Original)
+		}
+	}
+	if err := cfg.setAuthorHandles(ctx, all...); err != nil {
+		return err
+	}
+	if err := cfg.setTags(ctx, all...); err != nil {
+		return err
+	}
+	if err := cfg.setMentions(ctx, all...); err != nil {
+		return err
+	}
+	return cfg.setLikedByMe(ctx, all...)
+}
+
+// completeChirpsAll is completeChirps for a slice of chirps.
+func (cfg *apiConfig) completeChirpsAll(ctx context.Context, chirps []Chirp) error {
+	ptrs := make([]*Chirp, 0, len(chirps))
+	for i := range chirps {
+		ptrs = append(ptrs, &chirps[i])
+	}
+	return cfg.completeChirps(ctx, ptrs...)
 }
 
-func handlerPostChirp(w http.ResponseWriter, r *http.Request, apiConfig *apiConfig) {
+// handlerPostChirp posts a chirp. With in_reply_to it is a reply, with
+// quote_of a quote of another chirp, and with rechirp_of and no body a
+// rechirp that shares another chirp as is. Rechirping a rechirp rechirps
+// the chirp it shares, and rechirping the same chirp again responds with
+// the existing rechirp.
+func (cfg *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Body *string `json:"body"`
+		Body      *string    `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
+		QuoteOf   *uuid.UUID `json:"quote_of"`
+		RechirpOf *uuid.UUID `json:"rechirp_of"`
 	}
 	type response struct {
 		Chirp
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "No token in header", err)
+	userID, _ := auth.UserID(r.Context())
+
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+	if params.RechirpOf != nil {
+		cfg.postRechirp(w, r, userID, params.Body, params.InReplyTo, params.QuoteOf, *params.RechirpOf)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, apiConfig.JWTSecret)
+	var v validate.Validator
+	validateChirp(&v, params.Body, cfg.MaxChirpLength)
+	parentID, err := cfg.chirpRef(r.Context(), &v, "in_reply_to", params.InReplyTo)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token invalid", err)
+		respondWithError(w, r, errInternal, "Getting chirp failed", err)
+		return
+	}
+	quoteOf, err := cfg.chirpRef(r.Context(), &v, "quote_of", params.QuoteOf)
+	if err != nil {
+		respondWithError(w, r, errInternal, "Getting chirp failed", err)
+		return
+	}
+	if respondWithInvalid(w, r, &v) {
 		return
 	}
+	cleanedBody := cleanChirp(*params.Body)
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
+	var chirp database.Chirp
+	err = cfg.db.InTx(r.Context(), func(db store.Store) error {
+		var err error
+		chirp, err = db.CreateChirp(r.Context(), database.CreateChirpParams{
+			Body:     cleanedBody,
+			UserID:   userID,
+			ParentID: parentID,
+			QuoteOf:  quoteOf,
+		})
+		if err != nil {
+			return err
+		}
+		return indexChirp(r.Context(), db, chirp, true)
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Decoding parameters failed", err)
+		respondWithError(w, r, errInternal, "Creating chirp failed", err)
+		return
+	}
+	cfg.metrics.chirpsCreated.Inc()
+
+	resp := response{
+		Chirp: newChirp(chirp),
+	}
+	if err := cfg.completeChirps(r.Context(), &resp.Chirp); err != nil {
+		respondWithError(w, r, errInternal, "Getting chirp failed", err)
 		return
 	}
+	// Nobody can have liked a chirp that was just posted.
+	resp.LikedByMe = new(bool)
 
-	cleanedBody, err := validateChirp(params.Body)
+	respondWithJSON(w, http.StatusCreated, resp)
+}
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
-	var chirp database.Chirp
-	if err == nil {
-		dbQueries := database.New(db)
-		chirp, err = dbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
-			Body:   cleanedBody,
-			UserID: userID,
+func (cfg *apiConfig) postRechirp(w http.ResponseWriter, r *http.Request, userID uuid.UUID, body *string, inReplyTo, quoteOf *uuid.UUID, rechirpOf uuid.UUID) {
+	var v validate.Validator
+	v.Check(body == nil || *body == "", "body", "must be empty in a rechirp")
+	v.Check(inReplyTo == nil, "in_reply_to", "must be empty in a rechirp")
+	v.Check(quoteOf == nil, "quote_of", "must be empty in a rechirp")
+	originalID, err := cfg.chirpRef(r.Context(), &v, "rechirp_of", &rechirpOf)
+	if err != nil {
+		respondWithError(w, r, errInternal, "Getting chirp failed", err)
+		return
+	}
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	existing := database.GetRechirpParams{UserID: userID, RechirpOf: originalID}
+	status := http.StatusOK
+	chirp, err := cfg.db.GetRechirp(r.Context(), existing)
+	if errors.Is(err, sql.ErrNoRows) {
+		status = http.StatusCreated
+		chirp, err = cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
+			UserID:    userID,
+			RechirpOf: originalID,
 		})
+		if store.IsUniqueViolation(err, store.ChirpsRechirpKey) {
+			// A concurrent request rechirped it first.
+			status = http.StatusOK
+			chirp, err = cfg.db.GetRechirp(r.Context(), existing)
+		} else if err == nil {
+			cfg.metrics.chirpsCreated.Inc()
+		}
 	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Creating chirp failed.", err)
+		respondWithError(w, r, errInternal, "Rechirping failed", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, response{
-		Chirp: Chirp{
-			Id:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      cleanedBody,
-			UserID:    chirp.UserID,
-		},
-	})
+	resp := newChirp(chirp)
+	if err := cfg.completeChirps(r.Context(), &resp); err != nil {
+		respondWithError(w, r, errInternal, "Getting chirp failed", err)
+		return
+	}
+	respondWithJSON(w, status, resp)
+}
+
+// chirpRef checks that id, if set, refers to an existing chirp and returns
+// it as a reference to store. A reference to a rechirp is taken to be one to
+// the chirp it shares.
+func (cfg *apiConfig) chirpRef(ctx context.Context, v *validate.Validator, field string, id *uuid.UUID) (uuid.NullUUID, error) {
+	if id == nil {
+		return uuid.NullUUID{}, nil
+	}
+	chirp, err := cfg.db.GetChirp(ctx, *id)
+	if errors.Is(err, sql.ErrNoRows) {
+		v.Check(false, field, "must be the ID of an existing chirp")
+		return uuid.NullUUID{}, nil
+	}
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	if chirp.RechirpOf.Valid {
+		return chirp.RechirpOf, nil
+	}
+	return uuid.NullUUID{UUID: chirp.ID, Valid: true}, nil
 }
 
-func validateChirp(body *string) (string, error) {
-	if body == nil {
-		return "", errors.New("The request body doesn't contain the required field `body`")
+// indexChirp records the hashtags and mentions in the body of chirp,
+// replacing those of its previous body. A new chirp has nothing to replace,
+// so it only needs the queries for what its body has. db should be the
+// transaction that stored the body.
+func indexChirp(ctx context.Context, db store.Store, chirp database.Chirp, isNew bool) error {
+	tags := entities.Hashtags(chirp.Body)
+	if len(tags) > 0 || !isNew {
+		err := db.SetChirpTags(ctx, database.SetChirpTagsParams{ChirpID: chirp.ID, Names: tags})
+		if err != nil {
+			return err
+		}
 	}
-	const maxChirpLength = 140
-	if chirp_length := len(*body); chirp_length > maxChirpLength {
-		return "", errors.New("Chirp is too long")
+	handles := mentionedHandles(chirp.Body)
+	if len(handles) > 0 || !isNew {
+		err := db.SetChirpMentions(ctx, database.SetChirpMentionsParams{ChirpID: chirp.ID, Handles: handles})
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+func validateChirp(v *validate.Validator, body *string, maxChirpLength int) {
+	v.Required("body", body)
+	v.Length("body", body, 1, maxChirpLength)
+}
+
+func cleanChirp(body string) string {
 	const profanityReplacement = "****"
 	badWords := map[string]struct{}{
 		"kerfuffle": {},
 		"sharbert":  {},
 		"fornax":    {},
 	}
-	cleanedBody := getCleanedbody(body, badWords, profanityReplacement)
-	return cleanedBody, nil
+	return getCleanedbody(&body, badWords, profanityReplacement)
 }
+
 func getCleanedbody(body *string, badWords map[string]struct{}, replacement string) string {
 	words := strings.Split(*body, " ")
 	for i, word := range words {
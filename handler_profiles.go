@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/entities"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxProfileURLLength  = 2048
+)
+
+// Profile is the public view of a user, shown to anyone. Unlike User it
+// never includes the email address.
+type Profile struct {
+	Id            uuid.UUID `json:"id"`
+	Handle        string    `json:"handle"`
+	DisplayName   string    `json:"display_name"`
+	Bio           string    `json:"bio"`
+	Website       string    `json:"website"`
+	AvatarURL     string    `json:"avatar_url"`
+	CreatedAt     time.Time `json:"created_at"`
+	ChirpCount    int64     `json:"chirp_count"`
+	FollowerCount int64     `json:"follower_count"`
+}
+
+// validateProfile checks the profile fields of a user update. Each of them
+// is optional, and an empty string clears it.
+func validateProfile(v *validate.Validator, displayName, bio, website, avatarURL *string) {
+	v.Length("display_name", displayName, 0, maxDisplayNameLength)
+	v.Length("bio", bio, 0, maxBioLength)
+	validateProfileURL(v, "website", website)
+	validateProfileURL(v, "avatar_url", avatarURL)
+}
+
+// validateProfileURL rejects anything but an empty string or an absolute
+// http or https URL, so that a link on a profile cannot run script.
+func validateProfileURL(v *validate.Validator, field string, value *string) {
+	if value == nil || *value == "" {
+		return
+	}
+	u, err := url.Parse(*value)
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", field, "must be an http or https URL")
+	v.Check(len(*value) <= maxProfileURLLength, field, fmt.Sprintf("must be at most %d bytes long", maxProfileURLLength))
+}
+
+// handlerGetProfile shows the public profile of the user with the {handle}
+// path wildcard, in any case.
+func (cfg *apiConfig) handlerGetProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.userByHandle(w, r)
+	if !ok {
+		return
+	}
+	cfg.respondWithProfile(w, r, user)
+}
+
+// userByHandle looks up the user with the {handle} path wildcard, in any
+// case. If there is none it responds with an error and returns false.
+func (cfg *apiConfig) userByHandle(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	handle := r.PathValue("handle")
+	if !entities.ValidHandle(handle) {
+		respondWithError(w, r, errUserNotFound, "", nil)
+		return database.User{}, false
+	}
+	user, err := cfg.db.GetUserByHandle(r.Context(), handle)
+	if err != nil {
+		respondWithError(w, r, storeProblem(err, errUserNotFound), "", err)
+		return database.User{}, false
+	}
+	return user, true
+}
+
+func (cfg *apiConfig) respondWithProfile(w http.ResponseWriter, r *http.Request, user database.User) {
+	chirpCount, err := cfg.db.CountUserChirps(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, r, errInternal, "Counting chirps failed", err)
+		return
+	}
+	followerCount, err := cfg.db.CountFollowers(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, r, errInternal, "Counting followers failed", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Profile{
+		Id:            user.ID,
+		Handle:        user.Handle.String,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		Website:       user.Website,
+		AvatarURL:     user.AvatarUrl,
+		CreatedAt:     user.CreatedAt,
+		ChirpCount:    chirpCount,
+		FollowerCount: followerCount,
+	})
+}
+
+// setAuthorHandles fills in the handles of the authors of chirps with one
+// query however many chirps there are. Authors without a handle keep a nil
+// one.
+func (cfg *apiConfig) setAuthorHandles(ctx context.Context, chirps ...*Chirp) error {
+	var ids []uuid.UUID
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.UserID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	rows, err := cfg.db.GetUserHandles(ctx, ids)
+	if err != nil {
+		return err
+	}
+	handles := make(map[uuid.UUID]string, len(rows))
+	for _, row := range rows {
+		if row.Handle.Valid {
+			handles[row.ID] = row.Handle.String
+		}
+	}
+	for _, chirp := range chirps {
+		if handle, ok := handles[chirp.UserID]; ok {
+			chirp.AuthorHandle = &handle
+		}
+	}
+	return nil
+}
@@ -1,64 +1,54 @@
 package main
 
 import (
-	"database/sql"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/jakubbortlik/chirpy/internal/auth"
-	"github.com/jakubbortlik/chirpy/internal/database"
 )
 
-func handlerRefreshToken(w http.ResponseWriter, r *http.Request, apiConfig *apiConfig) {
+func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request) {
 	type response struct {
 		Token string `json:"token"`
 	}
 
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "No token in header", err)
+		respondWithError(w, r, tokenProblem(err), "", err)
 		return
 	}
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
-
+	refreshToken, err := cfg.db.GetRefreshToken(r.Context(), token)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Connecting to database failed", err)
-		return
-	}
-
-	dbQueries := database.New(db)
-	refreshToken, err := dbQueries.GetRefreshToken(r.Context(), token)
-
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Failed getting token from database", err)
+		respondWithError(w, r, storeProblem(err, errInvalidToken), "Unknown refresh token", err)
 		return
 	}
 
 	if refreshToken.ExpiresAt.Before(time.Now()) {
-		respondWithError(w, http.StatusUnauthorized, "Refresh token expired", err)
+		respondWithError(w, r, errTokenExpired, "Refresh token expired", nil)
 		return
 	}
 
 	if refreshToken.RevokedAt.Valid {
-		respondWithError(w, http.StatusUnauthorized, "Refresh token revoked", err)
+		respondWithError(w, r, errTokenRevoked, "Refresh token revoked", nil)
 		return
 	}
 
-	userID, err := dbQueries.GetUserFromRefreshToken(r.Context(), refreshToken.Token)
+	userID, err := cfg.db.GetUserFromRefreshToken(r.Context(), refreshToken.Token)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get user ID from database", err)
+		respondWithError(w, r, storeProblem(err, errInvalidToken), "Unknown refresh token", err)
 		return
 	}
+	setRequestUser(r, userID)
 
 	JWTToken, err := auth.MakeJWT(
 		userID,
-		apiConfig.JWTSecret,
+		cfg.JWTSecret,
+		cfg.AccessTokenTTL,
 	)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create JWT token", err)
+		respondWithError(w, r, errInternal, "Creating access token failed", err)
+		return
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
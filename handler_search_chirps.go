@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/search"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+)
+
+const maxSearchQueryLength = 256
+
+// handlerSearchChirps finds chirps matching the search query q, best match
+// first or, with sort=recent, newest first. Words in q must all match,
+// "quoted phrases" must match in order and a trailing * matches prefixes.
+// Results can be narrowed with author_id like in handlerGetChirps, and are
+// paginated with a Link header in the same way.
+func (cfg *apiConfig) handlerSearchChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var v validate.Validator
+	q := query.Get("q")
+	v.Required("q", &q)
+	v.Length("q", &q, 1, maxSearchQueryLength)
+	tsquery, err := search.Parse(q)
+	v.Check(err == nil, "q", "must contain a word to search for")
+	limit := queryInt(&v, r, "limit", defaultChirpPageSize, 1, maxChirpPageSize)
+	sort := query.Get("sort")
+	v.Check(sort == "" || sort == "relevance" || sort == "recent", "sort", "must be relevance or recent")
+	authorIDs := queryUUIDs(&v, r, "author_id")
+	c := query.Get("cursor")
+	var cursor searchCursor
+	if c != "" {
+		if sort == "recent" {
+			cursor.chirpCursor, err = parseChirpCursor(c)
+		} else {
+			cursor, err = parseSearchCursor(c)
+		}
+		v.Check(err == nil, "cursor", "must be a cursor from a previous response")
+	}
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	var chirps_data []database.Chirp
+	var next func(database.Chirp) string
+	if sort == "recent" {
+		params := database.SearchChirpsRecentParams{
+			Query:     tsquery,
+			AuthorIds: authorIDs,
+			Limit:     int32(limit) + 1,
+		}
+		if c != "" {
+			params.BeforeCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+			params.BeforeID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+		}
+		chirps_data, err = cfg.db.SearchChirpsRecent(r.Context(), params)
+		next = func(last database.Chirp) string {
+			return chirpCursor{CreatedAt: last.CreatedAt, ID: last.ID}.String()
+		}
+	} else {
+		params := database.SearchChirpsParams{
+			Query:     tsquery,
+			AuthorIds: authorIDs,
+			Limit:     int32(limit) + 1,
+		}
+		if c != "" {
+			params.BeforeRank = sql.NullFloat64{Float64: float64(cursor.Rank), Valid: true}
+			params.BeforeCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+			params.BeforeID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+		}
+		var rows []database.SearchChirpsRow
+		rows, err = cfg.db.SearchChirps(r.Context(), params)
+		ranks := make(map[uuid.UUID]float32, len(rows))
+		for _, row := range rows {
+			ranks[row.Chirp.ID] = row.Rank
+			chirps_data = append(chirps_data, row.Chirp)
+		}
+		next = func(last database.Chirp) string {
+			return searchCursor{
+				Rank:        ranks[last.ID],
+				chirpCursor: chirpCursor{CreatedAt: last.CreatedAt, ID: last.ID},
+			}.String()
+		}
+	}
+	if err != nil {
+		respondWithError(w, r, errInternal, "Searching chirps failed", err)
+		return
+	}
+	if len(chirps_data) > limit {
+		chirps_data = chirps_data[:limit]
+		setNextLink(w, r, next(chirps_data[limit-1]))
+	}
+
+	chirps := make([]Chirp, 0, len(chirps_data))
+	for _, chirp := range chirps_data {
+		chirps = append(chirps, newChirp(chirp))
+	}
+	if err := cfg.completeChirpsAll(r.Context(), chirps); err != nil {
+		respondWithError(w, r, errInternal, "Searching chirps failed", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
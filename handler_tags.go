@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/entities"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+)
+
+const (
+	defaultTrendingTags   = 10
+	maxTrendingTags       = 100
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+)
+
+// setTags fills in the tags of chirps with one query however many chirps
+// there are.
+func (cfg *apiConfig) setTags(ctx context.Context, chirps ...*Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.Id)
+	}
+	rows, err := cfg.db.GetChirpTags(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, chirp := range chirps {
+		chirp.Tags = []string{}
+		for _, row := range rows {
+			if row.ChirpID == chirp.Id {
+				chirp.Tags = append(chirp.Tags, row.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// handlerGetTagChirps lists the chirps tagged with a hashtag, newest first,
+// paginated like handlerGetChirps. The tag may be given with or without
+// its #, in any case.
+func (cfg *apiConfig) handlerGetTagChirps(w http.ResponseWriter, r *http.Request) {
+	var v validate.Validator
+	tag, ok := entities.NormalizeTag(r.PathValue("tag"))
+	v.Check(ok, "tag", "must be a hashtag")
+	limit := queryInt(&v, r, "limit", defaultChirpPageSize, 1, maxChirpPageSize)
+	params := database.ListTagChirpsParams{Tag: tag, Limit: int32(limit) + 1}
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		cursor, err := parseChirpCursor(c)
+		v.Check(err == nil, "cursor", "must be a cursor from a previous response")
+		params.BeforeCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: err == nil}
+		params.BeforeID = uuid.NullUUID{UUID: cursor.ID, Valid: err == nil}
+	}
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	chirps_data, err := cfg.db.ListTagChirps(r.Context(), params)
+	if err != nil {
+		respondWithError(w, r, errInternal, "Getting chirps failed", err)
+		return
+	}
+	if len(chirps_data) > limit {
+		chirps_data = chirps_data[:limit]
+		last := chirps_data[limit-1]
+		setNextLink(w, r, chirpCursor{CreatedAt: last.CreatedAt, ID: last.ID}.String())
+	}
+
+	chirps := make([]Chirp, 0, len(chirps_data))
+	for _, chirp := range chirps_data {
+		chirps = append(chirps, newChirp(chirp))
+	}
+	if err := cfg.completeChirpsAll(r.Context(), chirps); err != nil {
+		respondWithError(w, r, errInternal, "Getting chirps failed", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
+
+// handlerGetTrendingTags lists the tags of the most chirps posted within a
+// window, a Go duration such as 1h or 30m, ending now. Tags of equally many
+// chirps are in alphabetical order.
+func (cfg *apiConfig) handlerGetTrendingTags(w http.ResponseWriter, r *http.Request) {
+	type trendingTag struct {
+		Tag        string `json:"tag"`
+		ChirpCount int64  `json:"chirp_count"`
+	}
+
+	var v validate.Validator
+	limit := queryInt(&v, r, "limit", defaultTrendingTags, 1, maxTrendingTags)
+	window := queryDuration(&v, r, "window", defaultTrendingWindow, time.Minute, maxTrendingWindow)
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	rows, err := cfg.db.TrendingTags(r.Context(), database.TrendingTagsParams{
+		Since: time.Now().UTC().Add(-window),
+		Limit: int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, r, errInternal, "Getting trending tags failed", err)
+		return
+	}
+
+	tags := make([]trendingTag, 0, len(rows))
+	for _, row := range rows {
+		tags = append(tags, trendingTag{Tag: row.Name, ChirpCount: row.ChirpCount})
+	}
+	respondWithJSON(w, http.StatusOK, tags)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/auth"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/store"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+)
+
+// handlerUpdateChirp lets the author replace the body of a chirp. The body
+// goes through the same validation and cleaning as a new chirp, and the
+// previous body is kept as a revision. Submitting the current body again
+// changes nothing. A rechirp has no body to edit.
+func (cfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body *string `json:"body"`
+	}
+
+	userID, _ := auth.UserID(r.Context())
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, errInvalidID, "Invalid chirp ID", err)
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	var v validate.Validator
+	validateChirp(&v, params.Body, cfg.MaxChirpLength)
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, r, storeProblem(err, errChirpNotFound), "", err)
+		return
+	}
+	if chirp.UserID != userID {
+		respondWithError(w, r, errForbiddenNotOwner, "Only the author can edit a chirp", nil)
+		return
+	}
+	v.Check(!chirp.RechirpOf.Valid, "body", "cannot be set on a rechirp")
+	if respondWithInvalid(w, r, &v) {
+		return
+	}
+
+	cleanedBody := cleanChirp(*params.Body)
+	if cleanedBody != chirp.Body {
+		err = cfg.db.InTx(r.Context(), func(db store.Store) error {
+			chirp, err = db.UpdateChirp(r.Context(), database.UpdateChirpParams{
+				ID:   chirpID,
+				Body: cleanedBody,
+			})
+			if err != nil {
+				return err
+			}
+			return indexChirp(r.Context(), db, chirp, false)
+		})
+		if err != nil {
+			respondWithError(w, r, storeProblem(err, errChirpNotFound), "Updating chirp failed", err)
+			return
+		}
+	}
+
+	resp := newChirp(chirp)
+	if err := cfg.completeChirps(r.Context(), &resp); err != nil {
+		respondWithError(w, r, errInternal, "Getting chirp failed", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerGetChirpRevisions lists the previous bodies of a chirp, oldest
+// first. The current body is the chirp itself.
+func (cfg *apiConfig) handlerGetChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	type revision struct {
+		Id         uuid.UUID `json:"id"`
+		Body       string    `json:"body"`
+		CreatedAt  time.Time `json:"created_at"`
+		ReplacedAt time.Time `json:"replaced_at"`
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, errInvalidID, "Invalid chirp ID", err)
+		return
+	}
+	if _, err := cfg.db.GetChirp(r.Context(), chirpID); err != nil {
+		respondWithError(w, r, storeProblem(err, errChirpNotFound), "", err)
+		return
+	}
+
+	revisions, err := cfg.db.GetChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, r, errInternal, "Getting revisions failed", err)
+		return
+	}
+	resp := make([]revision, 0, len(revisions))
+	for _, rev := range revisions {
+		resp = append(resp, revision{
+			Id:         rev.ID,
+			Body:       rev.Body,
+			CreatedAt:  rev.CreatedAt,
+			ReplacedAt: rev.ReplacedAt,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -2,77 +2,109 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/jakubbortlik/chirpy/internal/auth"
 	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/entities"
+	"github.com/jakubbortlik/chirpy/internal/store"
+	"github.com/jakubbortlik/chirpy/internal/validate"
 )
 
-func handlerUpdateUser(w http.ResponseWriter, r *http.Request, apiConfig *apiConfig) {
+// handlerUpdateUser replaces the email and password of the authenticated
+// user. Their handle, which others can @mention them by, and the fields of
+// their public profile are only changed when given.
+func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Email    *string `json:"email"`
 		Password *string `json:"password"`
+		Handle   *string `json:"handle"`
+
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		Website     *string `json:"website"`
+		AvatarURL   *string `json:"avatar_url"`
 	}
 	type response struct {
 		User
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "No token in header", err)
-		return
-	}
+	userID, _ := auth.UserID(r.Context())
 
-	userID, err := auth.ValidateJWT(token, apiConfig.JWTSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token invalid", err)
-		return
-	}
-
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Decoding parameters failed", err)
+	if !decodeJSON(w, r, &params) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(*params.Password)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong", err)
+	var v validate.Validator
+	validateEmail(&v, params.Email)
+	validatePassword(&v, params.Password)
+	var handle sql.NullString
+	if params.Handle != nil {
+		v.Check(entities.ValidHandle(*params.Handle), "handle", fmt.Sprintf(
+			"must be %d to %d letters, digits or underscores", entities.MinHandleLength, entities.MaxHandleLength))
+		handle = sql.NullString{String: *params.Handle, Valid: true}
+	}
+	validateProfile(&v, params.DisplayName, params.Bio, params.Website, params.AvatarURL)
+	if respondWithInvalid(w, r, &v) {
 		return
 	}
+	if handle.Valid {
+		other, err := cfg.db.GetUserByHandle(r.Context(), handle.String)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, errInternal, "Getting user failed", err)
+			return
+		}
+		if err == nil && other.ID != userID {
+			respondWithError(w, r, errHandleTaken, "", nil)
+			return
+		}
+	}
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
-
+	hashedPassword, err := auth.HashPassword(*params.Password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Connecting to database failed", err)
+		respondWithError(w, r, errInternal, "Hashing password failed", err)
 		return
 	}
 
-	dbQueries := database.New(db)
 	updateUserParams := database.UpdateUserParams{
 		ID:             userID,
 		Email:          *params.Email,
 		HashedPassword: hashedPassword,
+		Handle:         handle,
+		DisplayName:    nullString(params.DisplayName),
+		Bio:            nullString(params.Bio),
+		Website:        nullString(params.Website),
+		AvatarUrl:      nullString(params.AvatarURL),
 	}
-	user, err := dbQueries.UpdateUser(r.Context(), updateUserParams)
+	user, err := cfg.db.UpdateUser(r.Context(), updateUserParams)
 
+	if store.IsUniqueViolation(err, store.UsersEmailKey) {
+		respondWithError(w, r, errEmailTaken, "", err)
+		return
+	}
+	if store.IsUniqueViolation(err, store.UsersHandleKey) {
+		// Another request took the handle after the check above.
+		respondWithError(w, r, errHandleTaken, "", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Updating user failed", err)
+		respondWithError(w, r, errInternal, "Updating user failed", err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			Id:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       &user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User: newUser(user),
 	})
 }
+
+// nullString converts an optional parameter for a query that keeps the
+// current value when it is null.
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
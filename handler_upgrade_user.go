@@ -2,20 +2,19 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
 
 	"github.com/google/uuid"
 	"github.com/jakubbortlik/chirpy/internal/auth"
-	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/validate"
 )
 
-func handlerUpgradeUser(w http.ResponseWriter, r *http.Request, apiConfig *apiConfig) {
+func (cfg *apiConfig) handlerUpgradeUser(w http.ResponseWriter, r *http.Request) {
 	key, err := auth.GetAPIKey(r.Header)
 
-	if key != apiConfig.PolkaKey {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized request", err)
+	if key != cfg.PolkaKey {
+		respondWithError(w, r, errInvalidAPIKey, "", err)
 		return
 	}
 
@@ -30,38 +29,39 @@ func handlerUpgradeUser(w http.ResponseWriter, r *http.Request, apiConfig *apiCo
 		User
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Decoding parameters failed", err)
+	if !decodeWebhookJSON(w, r, &params) {
 		return
 	}
-
-	if *params.Event != "user.upgraded" {
-		respondWithNoBody(w, http.StatusNoContent)
+	var v validate.Validator
+	v.Required("event", params.Event)
+	if params.Event != nil && *params.Event == "user.upgraded" {
+		v.Check(params.Data.UserID != uuid.Nil, "data.user_id", "is required")
+	}
+	if respondWithInvalid(w, r, &v) {
 		return
 	}
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Connecting to database failed", err)
+	if *params.Event != "user.upgraded" {
+		cfg.metrics.webhookEvent(*params.Event, "ignored")
+		respondWithNoBody(w, http.StatusNoContent)
 		return
 	}
 
-	dbQueries := database.New(db)
-	_, err = dbQueries.UpgradeUser(r.Context(), params.Data.UserID)
+	_, err = cfg.db.UpgradeUser(r.Context(), params.Data.UserID)
 
-	if err == sql.ErrNoRows {
-		respondWithError(w, http.StatusNotFound, "User not found in database", err)
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.metrics.webhookEvent(*params.Event, "user_not_found")
+		respondWithError(w, r, errUserNotFound, "", err)
 		return
 	}
 
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Upgrading user failed", err)
+		cfg.metrics.webhookEvent(*params.Event, "failed")
+		respondWithError(w, r, errInternal, "Upgrading user failed", err)
 		return
 	}
 
+	cfg.metrics.webhookEvent(*params.Event, "upgraded")
 	respondWithNoBody(w, http.StatusNoContent)
 }
@@ -2,17 +2,19 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
-	"github.com/jakubbortlik/chirpy/internal/auth"
-	"github.com/jakubbortlik/chirpy/internal/database"
+	"errors"
 	"net/http"
-	"os"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/auth"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
-func handlerUserLogin(w http.ResponseWriter, r *http.Request, apiConfig *apiConfig) {
+func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Password *string `json:"password"`
 		Email    *string `json:"email"`
@@ -23,30 +25,67 @@ func handlerUserLogin(w http.ResponseWriter, r *http.Request, apiConfig *apiConf
 		RefreshToken string `json:"refresh_token"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Decoding parameters failed", err)
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+	var v validate.Validator
+	v.Required("email", params.Email)
+	v.Required("password", params.Password)
+	if respondWithInvalid(w, r, &v) {
 		return
 	}
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+	ip := cfg.clientIP(r)
+	locked, err := cfg.loginLockedFor(r.Context(), accountThrottleKey(*params.Email), ipThrottleKey(ip))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Connecting to database failed", err)
+		respondWithError(w, r, errInternal, "Checking login throttle failed", err)
 		return
 	}
-	dbQueries := database.New(db)
-	user, err := dbQueries.GetUser(r.Context(), *params.Email)
-	errCompare := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(*params.Password))
+	if locked > 0 {
+		cfg.metrics.logins.WithLabelValues("blocked").Inc()
+		cfg.recordLoginEvent(r, *params.Email, uuid.Nil, loginEventBlocked)
+		w.Header().Set("Retry-After", ceilSeconds(locked))
+		respondWithError(w, r, errLoginLocked, "", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), *params.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, errInternal, "Getting user failed", err)
+		return
+	}
+	hash := user.HashedPassword
+	if err != nil {
+		hash = dummyPasswordHash()
+	}
+	errCompare := bcrypt.CompareHashAndPassword([]byte(hash), []byte(*params.Password))
 	if err != nil || errCompare != nil {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
+		cfg.metrics.logins.WithLabelValues("failure").Inc()
+		cfg.recordLoginEvent(r, *params.Email, user.ID, loginEventFailure)
+		lockedOut, errRecord := cfg.recordLoginFailure(r.Context(), *params.Email, ip)
+		if errRecord != nil {
+			respondWithError(w, r, errInternal, "Recording failed login failed", errRecord)
+			return
+		}
+		if lockedOut {
+			cfg.recordLoginEvent(r, *params.Email, user.ID, loginEventLocked)
+		}
+		respondWithError(w, r, errInvalidCredentials, "", errors.Join(err, errCompare))
+		return
+	}
+	cfg.metrics.logins.WithLabelValues("success").Inc()
+
+	setRequestUser(r, user.ID)
+	err = cfg.db.DeleteLoginThrottle(r.Context(), accountThrottleKey(*params.Email))
+	if err != nil {
+		respondWithError(w, r, errInternal, "Resetting login throttle failed", err)
 		return
 	}
+	cfg.recordLoginEvent(r, *params.Email, user.ID, loginEventSuccess)
 
 	refreshToken := auth.MakeRefreshToken()
-	expiresAt := time.Now().Add(60 * 24 * time.Hour)
+	expiresAt := time.Now().Add(cfg.RefreshTokenTTL)
 
 	createTokenParams := database.CreateRefreshTokenParams{
 		Token:     refreshToken,
@@ -54,26 +93,23 @@ func handlerUserLogin(w http.ResponseWriter, r *http.Request, apiConfig *apiConf
 		ExpiresAt: expiresAt,
 	}
 
-	err = dbQueries.CreateRefreshToken(r.Context(), createTokenParams)
+	err = cfg.db.CreateRefreshToken(r.Context(), createTokenParams)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Creating refresh token failed", err)
+		respondWithError(w, r, errInternal, "Creating refresh token failed", err)
+		return
 	}
 
 	JWTToken, err := auth.MakeJWT(
 		user.ID,
-		apiConfig.JWTSecret,
+		cfg.JWTSecret,
+		cfg.AccessTokenTTL,
 	)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create JWT token", err)
+		respondWithError(w, r, errInternal, "Creating access token failed", err)
+		return
 	}
 	respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			Id:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       &user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User:         newUser(user),
 		Token:        JWTToken,
 		RefreshToken: refreshToken,
 	})
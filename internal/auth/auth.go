@@ -18,6 +18,13 @@ type Tokentype string
 
 const TokenTypeAccess Tokentype = "chirpy-access"
 
+var (
+	// ErrNoAuthHeader is returned when a request has no Authorization header.
+	ErrNoAuthHeader = errors.New("authorization header not found")
+	// ErrTokenExpired is returned by ValidateJWT for expired tokens.
+	ErrTokenExpired = jwt.ErrTokenExpired
+)
+
 func HashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(hash), err
@@ -31,12 +38,13 @@ func CheckPasswordHash(password, hash string) error {
 func MakeJWT(
 	userID uuid.UUID,
 	tokenSecret string,
+	expiresIn time.Duration,
 ) (string, error) {
 	signingKey := []byte(tokenSecret)
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
 		Issuer:    string(TokenTypeAccess),
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Duration(3600)*time.Second)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
 		Subject:   userID.String(),
 	})
 	return token.SignedString(signingKey)
@@ -76,7 +84,7 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 func GetBearerToken(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
-		return "", fmt.Errorf("Authorization header not found.")
+		return "", ErrNoAuthHeader
 	}
 	splitAuth := strings.Split(authHeader, " ")
 	if len(splitAuth) < 2 || splitAuth[0] != "Bearer" {
@@ -88,7 +96,7 @@ func GetBearerToken(headers http.Header) (string, error) {
 func GetAPIKey(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
-		return "", fmt.Errorf("Authorization header not found.")
+		return "", ErrNoAuthHeader
 	}
 	splitAuth := strings.Split(authHeader, " ")
 	if len(splitAuth) < 2 || splitAuth[0] != "ApiKey" {
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"net/http"
 	"strings"
 	"testing"
@@ -120,7 +121,7 @@ func TestMakeJWT(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, err := MakeJWT(tt.userID, tt.createSecret)
+			token, err := MakeJWT(tt.userID, tt.createSecret, tt.expiresIn)
 			if (err != nil) != tt.wantMakeErr {
 				t.Errorf("MakeJWT() error = %v, wantErr %v", err, tt.wantMakeErr)
 			}
@@ -197,3 +198,20 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := UserID(ctx); ok {
+		t.Fatal("UserID() of empty context reported a user")
+	}
+
+	userID := uuid.New()
+	ctx = NewContext(ctx, Principal{UserID: userID})
+	got, ok := UserID(ctx)
+	if !ok || got != userID {
+		t.Errorf("UserID() = %v, %v; want %v, true", got, ok, userID)
+	}
+	if p, ok := FromContext(ctx); !ok || p.UserID != userID {
+		t.Errorf("FromContext() = %+v, %v", p, ok)
+	}
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID uuid.UUID
+	// IsAdmin is only set on routes that require the admin role, which is
+	// looked up for every request so that demotions take effect at once.
+	IsAdmin bool
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx, if any.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// UserID returns the ID of the authenticated user stored in ctx, if any.
+func UserID(ctx context.Context) (uuid.UUID, bool) {
+	p, ok := FromContext(ctx)
+	return p.UserID, ok
+}
@@ -0,0 +1,425 @@
+// Package config loads and validates Chirpy's runtime configuration.
+//
+// Every setting has an environment variable name (e.g. DB_URL) and a matching
+// command-line flag (e.g. -db-url). Values are resolved in this order, later
+// sources overriding earlier ones:
+//
+//  1. built-in defaults
+//  2. the config file given by -config or CHIRPY_CONFIG (KEY=value lines)
+//  3. environment variables
+//  4. command-line flags
+//
+// Any setting may instead be read from a file by setting KEY_FILE to its path,
+// which is how secrets are usually mounted in containers.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jakubbortlik/chirpy/internal/cors"
+	"github.com/jakubbortlik/chirpy/internal/ratelimit"
+	"github.com/joho/godotenv"
+)
+
+type Config struct {
+	ListenAddr   string
+	FilepathRoot string
+	Platform     string
+	LogLevel     slog.Level
+	LogFormat    string
+
+	Store             string
+	DBURL             string
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+	DBPingTimeout     time.Duration
+	MigrateOnStartup  bool
+
+	JWTSecret       string
+	PolkaKey        string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	LoginFailureWindow   time.Duration
+	LoginDelayAfter      int
+	LoginDelay           time.Duration
+	LoginMaxDelay        time.Duration
+	LoginLockoutAfter    int
+	LoginLockoutDuration time.Duration
+	LoginIPLockoutAfter  int
+
+	MaxChirpLength int
+
+	RateLimitBackend  string
+	RateLimits        map[string]ratelimit.Limit
+	TrustProxyHeaders bool
+
+	CORS cors.Options
+
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+}
+
+type setting struct {
+	key      string
+	def      string
+	usage    string
+	required bool
+	secret   bool
+	parse    func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{key: "ADDR", def: ":8080", usage: "address to listen on", parse: func(c *Config, v string) error {
+		c.ListenAddr = v
+		return nil
+	}},
+	{key: "FILEPATH_ROOT", def: ".", usage: "directory served under /app/", parse: func(c *Config, v string) error {
+		c.FilepathRoot = v
+		return nil
+	}},
+	{key: "PLATFORM", usage: `deployment platform; "dev" enables /admin/reset`, parse: func(c *Config, v string) error {
+		c.Platform = v
+		return nil
+	}},
+	{key: "LOG_LEVEL", def: "info", usage: "minimum log level: debug, info, warn or error", parse: func(c *Config, v string) error {
+		return c.LogLevel.UnmarshalText([]byte(v))
+	}},
+	{key: "LOG_FORMAT", def: "text", usage: `log output format, "text" or "json"`, parse: func(c *Config, v string) error {
+		if v != "text" && v != "json" {
+			return errors.New(`must be "text" or "json"`)
+		}
+		c.LogFormat = v
+		return nil
+	}},
+	{key: "STORE", def: "postgres", usage: `storage backend, "postgres" or "memory"`, parse: func(c *Config, v string) error {
+		if v != "postgres" && v != "memory" {
+			return errors.New(`must be "postgres" or "memory"`)
+		}
+		c.Store = v
+		return nil
+	}},
+	{key: "DB_URL", usage: "Postgres connection URL, required with STORE=postgres", secret: true, parse: func(c *Config, v string) error {
+		u, err := url.Parse(v)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+			return fmt.Errorf("scheme must be postgres or postgresql, got %q", u.Scheme)
+		}
+		c.DBURL = v
+		return nil
+	}},
+	{key: "DB_MAX_OPEN_CONNS", def: "25", usage: "maximum open database connections", parse: func(c *Config, v string) error {
+		return parseInt(&c.DBMaxOpenConns, v, 1)
+	}},
+	{key: "DB_MAX_IDLE_CONNS", def: "25", usage: "maximum idle database connections", parse: func(c *Config, v string) error {
+		return parseInt(&c.DBMaxIdleConns, v, 0)
+	}},
+	{key: "DB_CONN_MAX_LIFETIME", def: "30m", usage: "maximum lifetime of a database connection", parse: func(c *Config, v string) error {
+		return parseDuration(&c.DBConnMaxLifetime, v)
+	}},
+	{key: "DB_CONN_MAX_IDLE_TIME", def: "5m", usage: "maximum idle time of a database connection", parse: func(c *Config, v string) error {
+		return parseDuration(&c.DBConnMaxIdleTime, v)
+	}},
+	{key: "DB_PING_TIMEOUT", def: "5s", usage: "how long to wait for the database at startup", parse: func(c *Config, v string) error {
+		return parsePositiveDuration(&c.DBPingTimeout, v)
+	}},
+	{key: "MIGRATE_ON_STARTUP", def: "false", usage: "apply pending migrations before serving", parse: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.MigrateOnStartup = b
+		return err
+	}},
+	{key: "JWT_SECRET", usage: "secret used to sign access tokens", required: true, secret: true, parse: func(c *Config, v string) error {
+		c.JWTSecret = v
+		return nil
+	}},
+	{key: "POLKA_KEY", usage: "API key expected on Polka webhooks", required: true, secret: true, parse: func(c *Config, v string) error {
+		c.PolkaKey = v
+		return nil
+	}},
+	{key: "ACCESS_TOKEN_TTL", def: "1h", usage: "lifetime of access tokens", parse: func(c *Config, v string) error {
+		return parsePositiveDuration(&c.AccessTokenTTL, v)
+	}},
+	{key: "REFRESH_TOKEN_TTL", def: "1440h", usage: "lifetime of refresh tokens", parse: func(c *Config, v string) error {
+		return parsePositiveDuration(&c.RefreshTokenTTL, v)
+	}},
+	{key: "LOGIN_FAILURE_WINDOW", def: "1h", usage: "failed logins older than this are forgotten", parse: func(c *Config, v string) error {
+		return parsePositiveDuration(&c.LoginFailureWindow, v)
+	}},
+	{key: "LOGIN_DELAY_AFTER", def: "3", usage: "failed logins for an account before delays kick in", parse: func(c *Config, v string) error {
+		return parseInt(&c.LoginDelayAfter, v, 1)
+	}},
+	{key: "LOGIN_DELAY", def: "1s", usage: "first delay, doubled on every further failed login", parse: func(c *Config, v string) error {
+		return parsePositiveDuration(&c.LoginDelay, v)
+	}},
+	{key: "LOGIN_MAX_DELAY", def: "1m", usage: "upper bound on delays between failed logins", parse: func(c *Config, v string) error {
+		return parsePositiveDuration(&c.LoginMaxDelay, v)
+	}},
+	{key: "LOGIN_LOCKOUT_AFTER", def: "10", usage: "failed logins for an account before it is locked", parse: func(c *Config, v string) error {
+		return parseInt(&c.LoginLockoutAfter, v, 1)
+	}},
+	{key: "LOGIN_LOCKOUT_DURATION", def: "15m", usage: "how long a locked account or IP stays locked", parse: func(c *Config, v string) error {
+		return parsePositiveDuration(&c.LoginLockoutDuration, v)
+	}},
+	{key: "LOGIN_IP_LOCKOUT_AFTER", def: "100", usage: "failed logins from one IP before it is locked", parse: func(c *Config, v string) error {
+		return parseInt(&c.LoginIPLockoutAfter, v, 1)
+	}},
+	{key: "MAX_CHIRP_LENGTH", def: "140", usage: "maximum length of a chirp body", parse: func(c *Config, v string) error {
+		return parseInt(&c.MaxChirpLength, v, 1)
+	}},
+	{key: "RATE_LIMIT_BACKEND", def: "memory", usage: `where rate limits are tracked, "memory" or "postgres"`, parse: func(c *Config, v string) error {
+		if v != "memory" && v != "postgres" {
+			return errors.New(`must be "memory" or "postgres"`)
+		}
+		c.RateLimitBackend = v
+		return nil
+	}},
+	{key: "RATE_LIMITS", def: defaultRateLimits, usage: `comma separated "<route>=<requests>/<period>" limits, or "none"`, parse: parseRateLimits},
+	{key: "TRUST_PROXY_HEADERS", def: "false", usage: "use X-Forwarded-For to find the client IP", parse: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.TrustProxyHeaders = b
+		return err
+	}},
+	{key: "CORS_ALLOWED_ORIGINS", usage: `comma separated origins allowed to call /api from browsers, or "*"`, parse: func(c *Config, v string) error {
+		c.CORS.AllowedOrigins = parseList(v)
+		for _, origin := range c.CORS.AllowedOrigins {
+			if origin == "*" {
+				continue
+			}
+			u, err := url.Parse(origin)
+			if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+				return fmt.Errorf("origin %q must look like \"https://app.example.com\"", origin)
+			}
+		}
+		return nil
+	}},
+	{key: "CORS_ALLOWED_METHODS", def: "GET,POST,PUT,DELETE", usage: "comma separated methods allowed in cross-origin requests", parse: func(c *Config, v string) error {
+		c.CORS.AllowedMethods = parseList(v)
+		return nil
+	}},
+	{key: "CORS_ALLOWED_HEADERS", def: "Authorization,Content-Type,X-Request-ID", usage: "comma separated request headers allowed in cross-origin requests", parse: func(c *Config, v string) error {
+		c.CORS.AllowedHeaders = parseList(v)
+		return nil
+	}},
+	{key: "CORS_EXPOSED_HEADERS", def: defaultCORSExposedHeaders, usage: "comma separated response headers readable by cross-origin scripts", parse: func(c *Config, v string) error {
+		c.CORS.ExposedHeaders = parseList(v)
+		return nil
+	}},
+	{key: "CORS_ALLOW_CREDENTIALS", def: "false", usage: "let browsers send credentials with cross-origin requests", parse: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.CORS.AllowCredentials = b
+		return err
+	}},
+	{key: "CORS_MAX_AGE", def: "10m", usage: "how long browsers may cache preflight responses", parse: func(c *Config, v string) error {
+		return parseDuration(&c.CORS.MaxAge, v)
+	}},
+	{key: "SHUTDOWN_DELAY", def: "0s", usage: "how long to report unhealthy before closing the listener", parse: func(c *Config, v string) error {
+		return parseDuration(&c.ShutdownDelay, v)
+	}},
+	{key: "SHUTDOWN_TIMEOUT", def: "30s", usage: "how long to wait for in-flight requests on shutdown", parse: func(c *Config, v string) error {
+		return parsePositiveDuration(&c.ShutdownTimeout, v)
+	}},
+}
+
+// Load resolves the configuration from args (without the program name) and
+// the environment as seen through getenv. All problems are reported at once.
+func Load(args []string, getenv func(string) string) (Config, error) {
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFile := fs.String("config", getenv("CHIRPY_CONFIG"), "path to a KEY=value config file")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.key] = fs.String(flagName(s.key), "", s.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	fileValues := map[string]string{}
+	if *configFile != "" {
+		var err error
+		fileValues, err = godotenv.Read(*configFile)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading config file: %w", err)
+		}
+	}
+	lookup := func(key string) string {
+		if v := getenv(key); v != "" {
+			return v
+		}
+		return fileValues[key]
+	}
+
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	var cfg Config
+	var errs []error
+	for _, s := range settings {
+		value, err := resolve(s, lookup, setFlags, flagValues)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.key, err))
+			continue
+		}
+		if value == "" {
+			if s.required {
+				errs = append(errs, fmt.Errorf("%s: must be set", s.key))
+				continue
+			}
+			value = s.def
+		}
+		if value == "" {
+			continue
+		}
+		if err := s.parse(&cfg, value); err != nil {
+			if s.secret {
+				errs = append(errs, fmt.Errorf("%s: invalid value", s.key))
+			} else {
+				errs = append(errs, fmt.Errorf("%s: invalid value %q: %w", s.key, value, err))
+			}
+		}
+	}
+	if cfg.Store == "postgres" && cfg.DBURL == "" {
+		errs = append(errs, errors.New("DB_URL: must be set"))
+	}
+	if cfg.RateLimitBackend == "postgres" && cfg.Store != "postgres" {
+		errs = append(errs, errors.New("RATE_LIMIT_BACKEND: postgres needs STORE=postgres"))
+	}
+	if cfg.DBMaxIdleConns > cfg.DBMaxOpenConns {
+		errs = append(errs, errors.New("DB_MAX_IDLE_CONNS: must not exceed DB_MAX_OPEN_CONNS"))
+	}
+	if cfg.CORS.AllowCredentials && slices.Contains(cfg.CORS.AllowedOrigins, "*") {
+		errs = append(errs, errors.New(`CORS_ALLOW_CREDENTIALS: cannot be combined with CORS_ALLOWED_ORIGINS="*"`))
+	}
+	if cfg.LoginMaxDelay < cfg.LoginDelay {
+		errs = append(errs, errors.New("LOGIN_MAX_DELAY: must not be below LOGIN_DELAY"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// Usage writes the list of flags and the environment variables they map to.
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "  -config string\n    \tpath to a KEY=value config file (env CHIRPY_CONFIG)")
+	for _, s := range settings {
+		fmt.Fprintf(w, "  -%s string\n    \t%s (env %s", flagName(s.key), s.usage, s.key)
+		if s.def != "" {
+			fmt.Fprintf(w, ", default %q", s.def)
+		}
+		fmt.Fprintln(w, ")")
+	}
+}
+
+func resolve(s setting, lookup func(string) string, setFlags map[string]bool, flagValues map[string]*string) (string, error) {
+	if setFlags[flagName(s.key)] {
+		return *flagValues[s.key], nil
+	}
+	if value := lookup(s.key); value != "" {
+		return value, nil
+	}
+	if path := lookup(s.key + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", nil
+}
+
+const defaultRateLimits = "POST /api/chirps=30/1m,POST /api/users=5/1h,POST /api/login=10/1m"
+
+// defaultCORSExposedHeaders are the response headers clients need to follow
+// requests across logs, to paginate and to back off when rate limited.
+const defaultCORSExposedHeaders = "X-Request-ID,Link,Retry-After,RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,RateLimit-Policy"
+
+// parseRateLimits parses RATE_LIMITS, whose routes are ServeMux patterns
+// exactly as registered, e.g. "POST /api/chirps=30/1m".
+func parseRateLimits(c *Config, value string) error {
+	c.RateLimits = map[string]ratelimit.Limit{}
+	if value == "none" {
+		return nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		route, limit, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return fmt.Errorf("entry %q must look like \"POST /api/chirps=30/1m\"", entry)
+		}
+		if method, path, ok := strings.Cut(route, " "); !ok || method == "" || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("route %q must be a method followed by a path", route)
+		}
+		l, err := ratelimit.ParseLimit(limit)
+		if err != nil {
+			return err
+		}
+		c.RateLimits[route] = l
+	}
+	return nil
+}
+
+// parseList splits a comma separated list, dropping empty entries.
+func parseList(value string) []string {
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func flagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+func parseInt(dst *int, value string, min int) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	if n < min {
+		return fmt.Errorf("must be at least %d", min)
+	}
+	*dst = n
+	return nil
+}
+
+func parsePositiveDuration(dst *time.Duration, value string) error {
+	if err := parseDuration(dst, value); err != nil {
+		return err
+	}
+	if *dst == 0 {
+		return errors.New("must be positive")
+	}
+	return nil
+}
+
+func parseDuration(dst *time.Duration, value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return errors.New("must not be negative")
+	}
+	*dst = d
+	return nil
+}
@@ -0,0 +1,137 @@
+// Package cors implements Cross-Origin Resource Sharing so that browser
+// clients served from other origins can call the API.
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures which cross-origin requests browsers may make.
+type Options struct {
+	// AllowedOrigins lists origins such as "https://app.example.com" that
+	// may call the API, or "*" for any origin. CORS is disabled when empty.
+	AllowedOrigins []string
+	// AllowedMethods and AllowedHeaders are what preflighted requests may
+	// use. Header names are case-insensitive.
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are response headers that scripts may read.
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and HTTP authentication.
+	// It cannot be combined with the "*" origin.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight results.
+	MaxAge time.Duration
+}
+
+// Enabled reports whether any origin is allowed.
+func (o Options) Enabled() bool {
+	return len(o.AllowedOrigins) > 0
+}
+
+func (o Options) allowsAnyOrigin() bool {
+	return contains(o.AllowedOrigins, "*", false)
+}
+
+func (o Options) allowsOrigin(origin string) bool {
+	return o.allowsAnyOrigin() || contains(o.AllowedOrigins, origin, true)
+}
+
+// Handler returns a handler that adds CORS headers to the responses of next
+// and answers preflight requests itself. Requests without an Origin header
+// are passed through untouched.
+func (o Options) Handler(next http.Handler) http.Handler {
+	if !o.Enabled() {
+		return next
+	}
+	methods := strings.Join(o.AllowedMethods, ", ")
+	headers := strings.Join(o.AllowedHeaders, ", ")
+	exposed := strings.Join(o.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(o.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !o.allowsOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if preflight {
+			if !o.allowsPreflight(r) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			o.setOrigin(h, origin)
+			h.Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			if o.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		o.setOrigin(h, origin)
+		if exposed != "" {
+			h.Set("Access-Control-Expose-Headers", exposed)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (o Options) setOrigin(h http.Header, origin string) {
+	if o.allowsAnyOrigin() && !o.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if o.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// allowsPreflight reports whether the method and all headers requested by a
+// preflight request are allowed.
+func (o Options) allowsPreflight(r *http.Request) bool {
+	if !contains(o.AllowedMethods, r.Header.Get("Access-Control-Request-Method"), false) {
+		return false
+	}
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			header = strings.TrimSpace(header)
+			if header != "" && !contains(o.AllowedHeaders, header, true) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string, fold bool) bool {
+	for _, v := range list {
+		if v == s || fold && strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
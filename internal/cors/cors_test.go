@@ -0,0 +1,186 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	opts := Options{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "POST", "DELETE"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		ExposedHeaders: []string{"X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	}
+	wildcard := opts
+	wildcard.AllowedOrigins = []string{"*"}
+	credentials := opts
+	credentials.AllowCredentials = true
+
+	tests := []struct {
+		name        string
+		opts        Options
+		method      string
+		headers     map[string]string
+		wantStatus  int
+		wantHeaders map[string]string
+		wantNext    bool
+	}{
+		{
+			name:        "Same origin",
+			opts:        opts,
+			method:      "GET",
+			wantStatus:  http.StatusTeapot,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+			wantNext:    true,
+		},
+		{
+			name:       "Allowed origin",
+			opts:       opts,
+			method:     "GET",
+			headers:    map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusTeapot,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Expose-Headers":    "X-Request-ID",
+				"Access-Control-Allow-Credentials": "",
+				"Vary":                             "Origin",
+			},
+			wantNext: true,
+		},
+		{
+			name:        "Disallowed origin",
+			opts:        opts,
+			method:      "GET",
+			headers:     map[string]string{"Origin": "https://evil.example.com"},
+			wantStatus:  http.StatusTeapot,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+			wantNext:    true,
+		},
+		{
+			name:   "Preflight",
+			opts:   opts,
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "DELETE",
+				"Access-Control-Request-Headers": "authorization, content-type",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, POST, DELETE",
+				"Access-Control-Allow-Headers": "Authorization, Content-Type",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:   "Preflight with disallowed method",
+			opts:   opts,
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "PATCH",
+			},
+			wantStatus:  http.StatusNoContent,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:   "Preflight with disallowed header",
+			opts:   opts,
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "Authorization, X-Secret",
+			},
+			wantStatus:  http.StatusNoContent,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "Preflight from disallowed origin",
+			opts:   opts,
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                        "https://evil.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			wantStatus:  http.StatusNoContent,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:        "Plain OPTIONS request",
+			opts:        opts,
+			method:      "OPTIONS",
+			headers:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus:  http.StatusTeapot,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://app.example.com"},
+			wantNext:    true,
+		},
+		{
+			name:        "Wildcard origin",
+			opts:        wildcard,
+			method:      "GET",
+			headers:     map[string]string{"Origin": "https://anywhere.example.com"},
+			wantStatus:  http.StatusTeapot,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "*"},
+			wantNext:    true,
+		},
+		{
+			name:       "Credentials",
+			opts:       credentials,
+			method:     "GET",
+			headers:    map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusTeapot,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+			},
+			wantNext: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := tt.opts.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusTeapot)
+			}))
+			req := httptest.NewRequest(tt.method, "/api/chirps", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if called != tt.wantNext {
+				t.Errorf("next called = %v, want %v", called, tt.wantNext)
+			}
+			for k, want := range tt.wantHeaders {
+				if got := rec.Header().Get(k); got != want {
+					t.Errorf("%s = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerDisabled(t *testing.T) {
+	next := http.NotFoundHandler()
+	if h := (Options{}).Handler(next); h == nil {
+		t.Fatal("Handler() = nil")
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	(Options{}).Handler(next).ServeHTTP(rec, req)
+	if got := rec.Header().Get("Vary"); got != "" {
+		t.Errorf("Vary = %q, want no CORS headers when disabled", got)
+	}
+}
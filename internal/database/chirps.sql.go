@@ -7,25 +7,48 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countUserChirps = `-- name: CountUserChirps :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1
+`
+
+func (q *Queries) CountUserChirps(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUserChirps, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id, is_reply, rechirp_of, quote_of, is_quote)
 VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $3 IS NOT NULL, $4, $5, $5 IS NOT NULL
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, parent_id, is_reply, reply_count, like_count, rechirp_of, quote_of, is_quote, rechirp_count, quote_count
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	ParentID  uuid.NullUUID
+	RechirpOf uuid.NullUUID
+	QuoteOf   uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ParentID,
+		arg.RechirpOf,
+		arg.QuoteOf,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -33,6 +56,15 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ParentID,
+		&i.IsReply,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.IsQuote,
+		&i.RechirpCount,
+		&i.QuoteCount,
 	)
 	return i, err
 }
@@ -48,7 +80,7 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, parent_id, is_reply, reply_count, like_count, rechirp_of, quote_of, is_quote, rechirp_count, quote_count FROM chirps
 WHERE id = $1
 `
 
@@ -61,18 +93,344 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ParentID,
+		&i.IsReply,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.IsQuote,
+		&i.RechirpCount,
+		&i.QuoteCount,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1 OR $1 = '00000000-0000-0000-0000-000000000000'
-ORDER BY created_at ASC
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.parent_id, 1 AS depth
+    FROM chirps AS parent
+    JOIN chirps AS child ON child.parent_id = parent.id
+    WHERE child.id = $1
+    UNION ALL
+    SELECT chirps.id, chirps.parent_id, ancestors.depth + 1
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.parent_id
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.is_reply, chirps.reply_count, chirps.like_count, chirps.rechirp_of, chirps.quote_of, chirps.is_quote, chirps.rechirp_count, chirps.quote_count FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC
+`
+
+// GetChirpAncestors returns the chirps a chirp replies to, directly or
+// not, starting with the one that starts the thread.
+func (q *Queries) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.IsReply,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.IsQuote,
+			&i.RechirpCount,
+			&i.QuoteCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT chirps.id, 1 AS depth,
+        ARRAY[to_char(chirps.created_at, 'YYYYMMDDHH24MISSUS') || chirps.id::text] AS path
+    FROM chirps
+    WHERE chirps.parent_id = $3::uuid
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1,
+        descendants.path || (to_char(chirps.created_at, 'YYYYMMDDHH24MISSUS') || chirps.id::text)
+    FROM chirps
+    JOIN descendants ON chirps.parent_id = descendants.id
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.is_reply, chirps.reply_count, chirps.like_count, chirps.rechirp_of, chirps.quote_of, chirps.is_quote, chirps.rechirp_count, chirps.quote_count, descendants.depth::integer AS depth, descendants.path::text[] AS path
+FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+WHERE coalesce(cardinality($1::text[]), 0) = 0 OR descendants.path > $1::text[]
+ORDER BY descendants.path
+LIMIT $2
+`
+
+type GetChirpDescendantsParams struct {
+	AfterPath []string
+	Limit     int32
+	ID        uuid.UUID
+}
+
+type GetChirpDescendantsRow struct {
+	Chirp Chirp
+	Depth int32
+	Path  []string
+}
+
+// GetChirpDescendants returns a page of the replies below a chirp in thread
+// order: every reply is followed by the replies to it, and replies to the
+// same chirp are oldest first. path is the position of a reply in that order
+// and after_path, when not empty, the exclusive keyset bound.
+func (q *Queries) GetChirpDescendants(ctx context.Context, arg GetChirpDescendantsParams) ([]GetChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants, pq.Array(arg.AfterPath), arg.Limit, arg.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpDescendantsRow
+	for rows.Next() {
+		var i GetChirpDescendantsRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.ParentID,
+			&i.Chirp.IsReply,
+			&i.Chirp.ReplyCount,
+			&i.Chirp.LikeCount,
+			&i.Chirp.RechirpOf,
+			&i.Chirp.QuoteOf,
+			&i.Chirp.IsQuote,
+			&i.Chirp.RechirpCount,
+			&i.Chirp.QuoteCount,
+			&i.Depth,
+			pq.Array(&i.Path),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, parent_id, is_reply, reply_count, like_count, rechirp_of, quote_of, is_quote, rechirp_count, quote_count FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.IsReply,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.IsQuote,
+			&i.RechirpCount,
+			&i.QuoteCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRechirp = `-- name: GetRechirp :one
+SELECT id, created_at, updated_at, body, user_id, parent_id, is_reply, reply_count, like_count, rechirp_of, quote_of, is_quote, rechirp_count, quote_count FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2
+`
+
+type GetRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) GetRechirp(ctx context.Context, arg GetRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getRechirp, arg.UserID, arg.RechirpOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ParentID,
+		&i.IsReply,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.IsQuote,
+		&i.RechirpCount,
+		&i.QuoteCount,
+	)
+	return i, err
+}
+
+const listChirps = `-- name: ListChirps :many
+SELECT id, created_at, updated_at, body, user_id, parent_id, is_reply, reply_count, like_count, rechirp_of, quote_of, is_quote, rechirp_count, quote_count FROM chirps
+WHERE (coalesce(cardinality($1::uuid[]), 0) = 0 OR user_id = ANY($1::uuid[]))
+AND ($2::timestamp IS NULL OR created_at >= $2)
+AND ($3::timestamp IS NULL OR created_at < $3)
+AND (
+    $4::timestamp IS NULL
+    OR (created_at, id) > ($4, $5::uuid)
+)
+AND (
+    $6::timestamp IS NULL
+    OR (created_at, id) < ($6, $7::uuid)
+)
+ORDER BY created_at, id
+LIMIT $8
+`
+
+type ListChirpsParams struct {
+	AuthorIds       []uuid.UUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	Limit           int32
+}
+
+// ListChirps returns a page of chirps in (created_at, id) order. An empty
+// or null author_ids matches every author; the other filters apply when not
+// null. after_* and before_* are exclusive keyset bounds.
+func (q *Queries) ListChirps(ctx context.Context, arg ListChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirps,
+		pq.Array(arg.AuthorIds),
+		arg.Since,
+		arg.Until,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.IsReply,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.IsQuote,
+			&i.RechirpCount,
+			&i.QuoteCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, parent_id, is_reply, reply_count, like_count, rechirp_of, quote_of, is_quote, rechirp_count, quote_count FROM chirps
+WHERE (coalesce(cardinality($1::uuid[]), 0) = 0 OR user_id = ANY($1::uuid[]))
+AND ($2::timestamp IS NULL OR created_at >= $2)
+AND ($3::timestamp IS NULL OR created_at < $3)
+AND (
+    $4::timestamp IS NULL
+    OR (created_at, id) > ($4, $5::uuid)
+)
+AND (
+    $6::timestamp IS NULL
+    OR (created_at, id) < ($6, $7::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $8
 `
 
-func (q *Queries) GetChirps(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps, userID)
+type ListChirpsDescParams struct {
+	AuthorIds       []uuid.UUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	Limit           int32
+}
+
+// ListChirpsDesc is ListChirps in reverse order.
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		pq.Array(arg.AuthorIds),
+		arg.Since,
+		arg.Until,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +444,15 @@ func (q *Queries) GetChirps(ctx context.Context, userID uuid.UUID) ([]Chirp, err
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ParentID,
+			&i.IsReply,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.IsQuote,
+			&i.RechirpCount,
+			&i.QuoteCount,
 		); err != nil {
 			return nil, err
 		}
@@ -99,3 +466,186 @@ func (q *Queries) GetChirps(ctx context.Context, userID uuid.UUID) ([]Chirp, err
 	}
 	return items, nil
 }
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.is_reply, chirps.reply_count, chirps.like_count, chirps.rechirp_of, chirps.quote_of, chirps.is_quote, chirps.rechirp_count, chirps.quote_count, ts_rank(to_tsvector('english', body), to_tsquery('english', $1))::real AS rank
+FROM chirps
+WHERE to_tsvector('english', body) @@ to_tsquery('english', $1)
+AND (coalesce(cardinality($2::uuid[]), 0) = 0 OR user_id = ANY($2::uuid[]))
+AND (
+    $3::real IS NULL
+    OR (ts_rank(to_tsvector('english', body), to_tsquery('english', $1)), created_at, id)
+        < ($3, $4::timestamp, $5::uuid)
+)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT $6
+`
+
+type SearchChirpsParams struct {
+	Query           string
+	AuthorIds       []uuid.UUID
+	BeforeRank      sql.NullFloat64
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	Limit           int32
+}
+
+type SearchChirpsRow struct {
+	Chirp Chirp
+	Rank  float32
+}
+
+// SearchChirps returns a page of chirps matching query, a to_tsquery
+// expression, best match first. before_* is an exclusive keyset bound.
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		pq.Array(arg.AuthorIds),
+		arg.BeforeRank,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.ParentID,
+			&i.Chirp.IsReply,
+			&i.Chirp.ReplyCount,
+			&i.Chirp.LikeCount,
+			&i.Chirp.RechirpOf,
+			&i.Chirp.QuoteOf,
+			&i.Chirp.IsQuote,
+			&i.Chirp.RechirpCount,
+			&i.Chirp.QuoteCount,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirpsRecent = `-- name: SearchChirpsRecent :many
+SELECT id, created_at, updated_at, body, user_id, parent_id, is_reply, reply_count, like_count, rechirp_of, quote_of, is_quote, rechirp_count, quote_count FROM chirps
+WHERE to_tsvector('english', body) @@ to_tsquery('english', $1)
+AND (coalesce(cardinality($2::uuid[]), 0) = 0 OR user_id = ANY($2::uuid[]))
+AND (
+    $3::timestamp IS NULL
+    OR (created_at, id) < ($3, $4::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $5
+`
+
+type SearchChirpsRecentParams struct {
+	Query           string
+	AuthorIds       []uuid.UUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	Limit           int32
+}
+
+// SearchChirpsRecent is SearchChirps ordered newest first.
+func (q *Queries) SearchChirpsRecent(ctx context.Context, arg SearchChirpsRecentParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirpsRecent,
+		arg.Query,
+		pq.Array(arg.AuthorIds),
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.IsReply,
+			&i.ReplyCount,
+			&i.LikeCount,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.IsQuote,
+			&i.RechirpCount,
+			&i.QuoteCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+    SELECT gen_random_uuid(), id, body, updated_at, NOW()
+    FROM chirps
+    WHERE chirps.id = $2
+)
+UPDATE chirps
+SET body = $1, updated_at = NOW()
+WHERE chirps.id = $2
+RETURNING id, created_at, updated_at, body, user_id, parent_id, is_reply, reply_count, like_count, rechirp_of, quote_of, is_quote, rechirp_count, quote_count
+`
+
+type UpdateChirpParams struct {
+	Body string
+	ID   uuid.UUID
+}
+
+// UpdateChirp replaces the body of a chirp, keeping the previous body in
+// chirp_revisions.
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.Body, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ParentID,
+		&i.IsReply,
+		&i.ReplyCount,
+		&i.LikeCount,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.IsQuote,
+		&i.RechirpCount,
+		&i.QuoteCount,
+	)
+	return i, err
+}
@@ -12,11 +12,76 @@ import (
 )
 
 type Chirp struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.UUID
+	ParentID     uuid.NullUUID
+	IsReply      bool
+	ReplyCount   int32
+	LikeCount    int32
+	RechirpOf    uuid.NullUUID
+	QuoteOf      uuid.NullUUID
+	IsQuote      bool
+	RechirpCount int32
+	QuoteCount   int32
+}
+
+type ChirpLike struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpMention struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	Handle    string
+	CreatedAt time.Time
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type ChirpTag struct {
+	ChirpID   uuid.UUID
+	TagID     uuid.UUID
+	CreatedAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type LoginEvent struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
+	Email     string
+	UserID    uuid.NullUUID
+	Ip        string
+	Event     string
+}
+
+type LoginThrottle struct {
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
 	UpdatedAt time.Time
-	Body      string
-	UserID    uuid.UUID
 }
 
 type RefreshToken struct {
@@ -28,6 +93,12 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime
 }
 
+type Tag struct {
+	ID        uuid.UUID
+	Name      string
+	CreatedAt time.Time
+}
+
 type User struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
@@ -35,4 +106,10 @@ type User struct {
 	Email          string
 	HashedPassword string
 	IsChirpyRed    bool
+	IsAdmin        bool
+	Handle         sql.NullString
+	DisplayName    string
+	Bio            string
+	Website        string
+	AvatarUrl      string
 }
@@ -0,0 +1,132 @@
+// Package entities finds the parts of a chirp body that mean more than
+// their text: #hashtags and @mentions.
+package entities
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxTagLength is the length in characters of the longest hashtag, not
+	// counting the #.
+	MaxTagLength = 64
+
+	// MinHandleLength and MaxHandleLength bound the length of user handles,
+	// not counting the @.
+	MinHandleLength = 3
+	MaxHandleLength = 30
+)
+
+// Mention is an @handle in a chirp body. Start and End are offsets in
+// characters (Unicode code points) of the whole mention, @ included; End is
+// exclusive.
+type Mention struct {
+	Handle     string
+	Start, End int
+}
+
+// Hashtags returns the hashtags in body, lower-cased, without the # and
+// without duplicates, in the order they first appear. A hashtag is a # at
+// the start of a word followed by letters, digits and underscores, at least
+// one of them a letter, so "#1" and "a#b" are not hashtags.
+func Hashtags(body string) []string {
+	var tags []string
+	for _, m := range scan(body, '#') {
+		tag, ok := NormalizeTag(m.text)
+		if ok && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// NormalizeTag returns tag, with or without its #, the way Hashtags would
+// return it, and whether it is a valid hashtag at all.
+func NormalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	n := utf8.RuneCountInString(tag)
+	if n == 0 || n > MaxTagLength {
+		return "", false
+	}
+	hasLetter := false
+	for _, r := range tag {
+		if !isWordRune(r) {
+			return "", false
+		}
+		hasLetter = hasLetter || unicode.IsLetter(r)
+	}
+	if !hasLetter {
+		return "", false
+	}
+	return tag, true
+}
+
+// Mentions returns every @handle in body, in order, with the handle as
+// written. Like a hashtag, a mention starts a word; unlike one, it must be a
+// valid handle, so "a@example.com" and "@x" are not mentions.
+func Mentions(body string) []Mention {
+	var mentions []Mention
+	for _, m := range scan(body, '@') {
+		if !ValidHandle(m.text) {
+			continue
+		}
+		start := utf8.RuneCountInString(body[:m.start])
+		mentions = append(mentions, Mention{
+			Handle: m.text,
+			Start:  start,
+			End:    start + utf8.RuneCountInString(body[m.start:m.end]),
+		})
+	}
+	return mentions
+}
+
+// ValidHandle reports whether handle, without its @, is a valid user
+// handle: MinHandleLength to MaxHandleLength ASCII letters, digits and
+// underscores.
+func ValidHandle(handle string) bool {
+	if len(handle) < MinHandleLength || len(handle) > MaxHandleLength {
+		return false
+	}
+	for _, r := range handle {
+		if r > unicode.MaxASCII || !isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// match is a word in a body that starts with a sigil. start and end are
+// byte offsets of the whole match, sigil included; text excludes the sigil.
+type match struct {
+	text       string
+	start, end int
+}
+
+// scan finds the runs of word characters that follow sigil at the start of
+// a word in body. A doubled sigil starts nothing.
+func scan(body string, sigil rune) []match {
+	var matches []match
+	prev := ' '
+	for i, r := range body {
+		if r == sigil && prev != sigil && !isWordRune(prev) {
+			rest := body[i+utf8.RuneLen(r):]
+			n := strings.IndexFunc(rest, func(r rune) bool { return !isWordRune(r) })
+			if n < 0 {
+				n = len(rest)
+			}
+			if n > 0 {
+				start := i + utf8.RuneLen(r)
+				matches = append(matches, match{text: body[start : start+n], start: i, end: start + n})
+			}
+		}
+		prev = r
+	}
+	return matches
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_'
+}
@@ -0,0 +1,106 @@
+package entities
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "None", body: "just words", want: nil},
+		{name: "Single", body: "#golang", want: []string{"golang"}},
+		{name: "Lower-cased", body: "I love #GoLang", want: []string{"golang"}},
+		{name: "Several in order", body: "#b then #a", want: []string{"b", "a"}},
+		{name: "Duplicates", body: "#go #Go #GO", want: []string{"go"}},
+		{name: "Punctuation ends a tag", body: "(#chirpy), #sql!", want: []string{"chirpy", "sql"}},
+		{name: "Underscores and digits", body: "#go_1_22", want: []string{"go_1_22"}},
+		{name: "Digits only", body: "#1 #2024", want: nil},
+		{name: "Inside a word", body: "a#b c#", want: nil},
+		{name: "Lone hash", body: "# #", want: nil},
+		{name: "Double hash", body: "##tag", want: nil},
+		{name: "Unicode", body: "#Příliš žluťoučký", want: []string{"příliš"}},
+		{name: "Too long", body: "#" + strings.Repeat("a", MaxTagLength+1), want: nil},
+		{name: "Longest", body: "#" + strings.Repeat("a", MaxTagLength), want: []string{strings.Repeat("a", MaxTagLength)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Hashtags(tt.body); !slices.Equal(got, tt.want) {
+				t.Errorf("Hashtags(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		tag    string
+		want   string
+		wantOK bool
+	}{
+		{tag: "Go", want: "go", wantOK: true},
+		{tag: "#Go", want: "go", wantOK: true},
+		{tag: "", wantOK: false},
+		{tag: "#", wantOK: false},
+		{tag: "42", wantOK: false},
+		{tag: "two words", wantOK: false},
+		{tag: "##go", wantOK: false},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizeTag(tt.tag)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("NormalizeTag(%q) = %q, %t; want %q, %t", tt.tag, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Mention
+	}{
+		{name: "None", body: "no one here", want: nil},
+		{name: "Single", body: "@bob", want: []Mention{{Handle: "bob", Start: 0, End: 4}}},
+		{name: "Case kept", body: "hi @Bob_42!", want: []Mention{{Handle: "Bob_42", Start: 3, End: 10}}},
+		{name: "Repeated", body: "@bob @bob", want: []Mention{{Handle: "bob", Start: 0, End: 4}, {Handle: "bob", Start: 5, End: 9}}},
+		{name: "Offsets in characters", body: "žluťoučký @kůň @bob", want: []Mention{{Handle: "bob", Start: 15, End: 19}}},
+		{name: "Email address", body: "mail bob@example.com", want: nil},
+		{name: "Too short", body: "@x", want: nil},
+		{name: "Too long", body: "@" + strings.Repeat("a", MaxHandleLength+1), want: nil},
+		{name: "Double at", body: "@@bob", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Mentions(tt.body); !slices.Equal(got, tt.want) {
+				t.Errorf("Mentions(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidHandle(t *testing.T) {
+	tests := []struct {
+		handle string
+		want   bool
+	}{
+		{handle: "bob", want: true},
+		{handle: "Bob_42", want: true},
+		{handle: "42", want: false},
+		{handle: "bo", want: false},
+		{handle: strings.Repeat("a", MaxHandleLength), want: true},
+		{handle: strings.Repeat("a", MaxHandleLength+1), want: false},
+		{handle: "bob smith", want: false},
+		{handle: "@bob", want: false},
+		{handle: "kůň", want: false},
+	}
+	for _, tt := range tests {
+		if got := ValidHandle(tt.handle); got != tt.want {
+			t.Errorf("ValidHandle(%q) = %t, want %t", tt.handle, got, tt.want)
+		}
+	}
+}
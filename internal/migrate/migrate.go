@@ -0,0 +1,109 @@
+// Package migrate applies the embedded goose migrations from sql/schema.
+//
+// Every operation holds a Postgres advisory lock for its duration, so several
+// replicas migrating on startup at the same time apply each migration once.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jakubbortlik/chirpy/sql/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// Commands lists the commands understood by Run.
+var Commands = []string{"up", "down", "status", "redo"}
+
+func newProvider(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, schema.Migrations,
+		goose.WithSessionLocker(locker),
+	)
+}
+
+// Up applies all pending migrations and returns how many were applied.
+func Up(ctx context.Context, db *sql.DB) (int, error) {
+	provider, err := newProvider(db)
+	if err != nil {
+		return 0, err
+	}
+	results, err := provider.Up(ctx)
+	return len(results), err
+}
+
+// Run executes command against db and writes a human readable report to w.
+func Run(ctx context.Context, db *sql.DB, command string, w io.Writer) error {
+	provider, err := newProvider(db)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		results, err := provider.Up(ctx)
+		printResults(w, results...)
+		if err == nil && len(results) == 0 {
+			fmt.Fprintln(w, "no migrations to apply")
+		}
+		return err
+	case "down":
+		result, err := provider.Down(ctx)
+		if errors.Is(err, goose.ErrNoNextVersion) {
+			fmt.Fprintln(w, "no migrations to roll back")
+			return nil
+		}
+		printResults(w, result)
+		return err
+	case "redo":
+		version, err := provider.GetDBVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			return errors.New("no migration has been applied yet")
+		}
+		result, err := provider.Down(ctx)
+		printResults(w, result)
+		if err != nil {
+			return err
+		}
+		result, err = provider.ApplyVersion(ctx, version, true)
+		printResults(w, result)
+		return err
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tSTATE\tAPPLIED AT\tFILE")
+		for _, s := range statuses {
+			appliedAt := "-"
+			if s.State == goose.StateApplied {
+				appliedAt = s.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Source.Version, s.State, appliedAt, s.Source.Path)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected one of %v", command, Commands)
+	}
+}
+
+func printResults(w io.Writer, results ...*goose.MigrationResult) {
+	for _, r := range results {
+		if r != nil {
+			fmt.Fprintln(w, r)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jakubbortlik/chirpy/sql/schema"
+	_ "github.com/lib/pq"
+)
+
+func TestMigrationsEmbedded(t *testing.T) {
+	files, err := fs.Glob(schema.Migrations, "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(schema.Migrations, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(data, []byte("-- +goose Up")) || !bytes.Contains(data, []byte("-- +goose Down")) {
+			t.Errorf("%s must contain both goose Up and Down sections", file)
+		}
+	}
+}
+
+// TestRun migrates a scratch database all the way down and back up. It is
+// skipped unless CHIRPY_TEST_DB_URL is set.
+func TestRun(t *testing.T) {
+	dbURL := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("CHIRPY_TEST_DB_URL not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := Up(ctx, db); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	for _, command := range []string{"redo", "down", "up", "status"} {
+		var out strings.Builder
+		if err := Run(ctx, db, command, &out); err != nil {
+			t.Fatalf("Run(%q) error = %v", command, err)
+		}
+		t.Logf("%s:\n%s", command, out.String())
+	}
+	if err := Run(ctx, db, "sideways", &strings.Builder{}); err == nil {
+		t.Error("Run() with an unknown command should fail")
+	}
+}
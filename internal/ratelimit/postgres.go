@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/jakubbortlik/chirpy/internal/database"
+)
+
+// Postgres keeps buckets in the rate_limit_buckets table so that all
+// instances sharing the database share the limits.
+type Postgres struct {
+	db *database.Queries
+}
+
+var _ Backend = (*Postgres)(nil)
+
+func NewPostgres(db database.DBTX) *Postgres {
+	return &Postgres{db: database.New(db)}
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	row, err := p.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: float64(limit.Burst),
+		Rate:  limit.rate(),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(limit, row.Tokens, row.Allowed), nil
+}
+
+func (p *Postgres) Cleanup(ctx context.Context, idle time.Duration) error {
+	return p.db.DeleteIdleRateLimitBuckets(ctx, idle.Seconds())
+}
@@ -0,0 +1,87 @@
+// Package ratelimit implements token bucket rate limiting with pluggable
+// storage: Memory for a single instance and Postgres for limits shared by
+// several instances.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Burst requests at once, refilled at Burst per Period.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseLimit parses limits written as "<requests>/<period>", e.g. "30/1m".
+func ParseLimit(s string) (Limit, error) {
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q must look like 30/1m", s)
+	}
+	burst, err := strconv.Atoi(requests)
+	if err != nil || burst < 1 {
+		return Limit{}, fmt.Errorf("limit %q must allow at least one request", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("limit %q must have a positive period", s)
+	}
+	return Limit{Burst: burst, Period: d}, nil
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// rate is the refill rate in tokens per second.
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// Result describes the state of a bucket after a request tried to take a
+// token from it.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next request would be allowed; it is
+	// zero when Allowed is true.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+func newResult(limit Limit, tokens float64, allowed bool) Result {
+	rate := limit.rate()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     secondsToDuration((float64(limit.Burst) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+	return res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// Backend stores token buckets.
+type Backend interface {
+	// Take tries to take a token from the bucket identified by key, creating
+	// a full bucket if there is none yet.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// Cleanup forgets buckets that have not been used for longer than
+	// idle. Any bucket idle for a full period has refilled completely, so
+	// forgetting it does not change the outcome of future requests.
+	Cleanup(ctx context.Context, idle time.Duration) error
+}
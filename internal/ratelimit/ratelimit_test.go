@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Limit
+		wantErr bool
+	}{
+		{input: "30/1m", want: Limit{Burst: 30, Period: time.Minute}},
+		{input: "1/1h", want: Limit{Burst: 1, Period: time.Hour}},
+		{input: "30", wantErr: true},
+		{input: "0/1m", wantErr: true},
+		{input: "ten/1m", wantErr: true},
+		{input: "10/soon", wantErr: true},
+		{input: "10/-1m", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseLimit(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	limit := Limit{Burst: 2, Period: 10 * time.Second}
+
+	steps := []struct {
+		name          string
+		advance       time.Duration
+		key           string
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{name: "First request", key: "a", wantAllowed: true, wantRemaining: 1},
+		{name: "Second request", key: "a", wantAllowed: true, wantRemaining: 0},
+		{name: "Bucket empty", key: "a", wantAllowed: false, wantRemaining: 0, wantRetry: 5 * time.Second},
+		{name: "Other key has its own bucket", key: "b", wantAllowed: true, wantRemaining: 1},
+		{name: "Partially refilled", advance: 5 * time.Second, key: "a", wantAllowed: true, wantRemaining: 0},
+		{name: "Refill is capped at burst", advance: time.Hour, key: "a", wantAllowed: true, wantRemaining: 1},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		res, err := m.Take(ctx, step.key, limit)
+		if err != nil {
+			t.Fatalf("%s: Take() error = %v", step.name, err)
+		}
+		if res.Allowed != step.wantAllowed || res.Remaining != step.wantRemaining || res.RetryAfter != step.wantRetry {
+			t.Errorf("%s: Take() = %+v, want allowed %v, remaining %d, retry after %s",
+				step.name, res, step.wantAllowed, step.wantRemaining, step.wantRetry)
+		}
+		if res.Limit != limit.Burst {
+			t.Errorf("%s: Limit = %d, want %d", step.name, res.Limit, limit.Burst)
+		}
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := m.Cleanup(ctx, time.Hour); err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+	if len(m.buckets) != 0 {
+		t.Errorf("Cleanup() left %d idle buckets", len(m.buckets))
+	}
+}
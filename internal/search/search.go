@@ -0,0 +1,113 @@
+// Package search turns what users type into a search box into Postgres
+// to_tsquery expressions, and matches text against those expressions the
+// way the in-memory store needs.
+package search
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// ErrEmpty is returned by Parse when the input has no words to search for.
+var ErrEmpty = errors.New("search query has no words")
+
+const (
+	and    = " & "
+	follow = " <-> "
+	prefix = ":*"
+)
+
+// Parse converts q into a to_tsquery expression. Words are ANDed together,
+// "double-quoted phrases" match only adjacent words in order, and a word
+// ending in * matches any word it is a prefix of. Punctuation separates
+// words, so the result never needs quoting.
+func Parse(q string) (string, error) {
+	var groups []string
+	for i, part := range strings.Split(q, `"`) {
+		// Odd parts are inside quotes; an unbalanced quote runs to the end.
+		if i%2 == 1 {
+			if terms := terms(part); len(terms) > 0 {
+				groups = append(groups, "("+strings.Join(terms, follow)+")")
+			}
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			groups = append(groups, terms(field)...)
+		}
+	}
+	if len(groups) == 0 {
+		return "", ErrEmpty
+	}
+	return strings.Join(groups, and), nil
+}
+
+// terms splits s into lower-case words, keeping a trailing * on a word as
+// the tsquery prefix marker.
+func terms(s string) []string {
+	var terms []string
+	for _, field := range strings.Fields(s) {
+		words := words(field)
+		if len(words) == 0 {
+			continue
+		}
+		if strings.HasSuffix(field, "*") {
+			words[len(words)-1] += prefix
+		}
+		terms = append(terms, words...)
+	}
+	return terms
+}
+
+// words splits s into lower-case runs of letters and digits.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Match reports whether text matches query, an expression returned by
+// Parse, and how well: the rank is the number of times the query's words
+// and phrases occur in text relative to its length. Unlike Postgres, Match
+// neither stems words nor drops stop words.
+func Match(query, text string) (rank float32, ok bool) {
+	words := words(text)
+	if len(words) == 0 {
+		return 0, false
+	}
+	hits := 0
+	for _, group := range strings.Split(query, and) {
+		terms := strings.Split(strings.Trim(group, "()"), follow)
+		n := occurrences(words, terms)
+		if n == 0 {
+			return 0, false
+		}
+		hits += n
+	}
+	return float32(hits) / float32(len(words)), true
+}
+
+// occurrences counts the positions in words where terms match in sequence.
+func occurrences(words, terms []string) int {
+	n := 0
+	for i := 0; i+len(terms) <= len(words); i++ {
+		match := true
+		for j, term := range terms {
+			if !matchTerm(words[i+j], term) {
+				match = false
+				break
+			}
+		}
+		if match {
+			n++
+		}
+	}
+	return n
+}
+
+func matchTerm(word, term string) bool {
+	if p, ok := strings.CutSuffix(term, prefix); ok {
+		return strings.HasPrefix(word, p)
+	}
+	return word == term
+}
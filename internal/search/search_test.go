@@ -0,0 +1,74 @@
+package search
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       string
+		want    string
+		wantErr error
+	}{
+		{name: "Single word", q: "Gopher", want: "gopher"},
+		{name: "Words are ANDed", q: "  pebble   lantern ", want: "pebble & lantern"},
+		{name: "Prefix", q: "goph*", want: "goph:*"},
+		{name: "Phrase", q: `"I hear Mastodon"`, want: "(i <-> hear <-> mastodon)"},
+		{name: "Phrase with prefix", q: `"better than twit*"`, want: "(better <-> than <-> twit:*)"},
+		{name: "Mixed", q: `go "generic types" chirp*`, want: "go & (generic <-> types) & chirp:*"},
+		{name: "Unbalanced quote", q: `"hello world`, want: "(hello <-> world)"},
+		{name: "Punctuation separates words", q: "don't & (drop) | tables!", want: "don & t & drop & tables"},
+		{name: "Unicode", q: "Příliš žluťoučký", want: "příliš & žluťoučký"},
+		{name: "Empty", q: "", wantErr: ErrEmpty},
+		{name: "Only punctuation", q: `"" * & !`, wantErr: ErrEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.q)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse(%q) error = %v, want %v", tt.q, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %q, want %q", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	const text = "I had something interesting for breakfast, something tasty."
+	tests := []struct {
+		name     string
+		q        string
+		want     bool
+		wantRank float32
+	}{
+		{name: "Word", q: "breakfast", want: true, wantRank: 1.0 / 8},
+		{name: "Repeated word ranks higher", q: "something", want: true, wantRank: 2.0 / 8},
+		{name: "All words", q: "breakfast tasty", want: true, wantRank: 2.0 / 8},
+		{name: "Missing word", q: "breakfast lunch", want: false},
+		{name: "Prefix", q: "interest*", want: true, wantRank: 1.0 / 8},
+		{name: "Prefix needs the start of a word", q: "esting*", want: false},
+		{name: "Phrase", q: `"for breakfast"`, want: true, wantRank: 1.0 / 8},
+		{name: "Phrase out of order", q: `"breakfast for"`, want: false},
+		{name: "Phrase with prefix", q: `"something tas*"`, want: true, wantRank: 1.0 / 8},
+		{name: "Case insensitive", q: "BREAKFAST", want: true, wantRank: 1.0 / 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := Parse(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rank, ok := Match(query, text)
+			if ok != tt.want || rank != tt.wantRank {
+				t.Errorf("Match(%q) = %v, %v; want %v, %v", query, rank, ok, tt.wantRank, tt.want)
+			}
+		})
+	}
+	if _, ok := Match("anything", ""); ok {
+		t.Error("Match() of empty text = true")
+	}
+}
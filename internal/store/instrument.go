@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/jakubbortlik/chirpy/internal/database"
+)
+
+// QueryObserver is told how long each query took. name is the sqlc query
+// name, e.g. "GetChirp".
+type QueryObserver func(name string, duration time.Duration, err error)
+
+// instrumentedDB times every query sent through the sqlc-generated code.
+type instrumentedDB struct {
+	db      database.DBTX
+	observe QueryObserver
+}
+
+func (i instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := i.db.ExecContext(ctx, query, args...)
+	i.observe(queryName(query), time.Since(start), err)
+	return res, err
+}
+
+func (i instrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return i.db.PrepareContext(ctx, query)
+}
+
+func (i instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := i.db.QueryContext(ctx, query, args...)
+	i.observe(queryName(query), time.Since(start), err)
+	return rows, err
+}
+
+func (i instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := i.db.QueryRowContext(ctx, query, args...)
+	i.observe(queryName(query), time.Since(start), row.Err())
+	return row
+}
+
+// queryName extracts the name from the "-- name: GetChirp :one" comment sqlc
+// puts at the start of every query.
+func queryName(query string) string {
+	const prefix = "-- name: "
+	if !strings.HasPrefix(query, prefix) {
+		return "unknown"
+	}
+	name, _, _ := strings.Cut(query[len(prefix):], " ")
+	return name
+}
@@ -0,0 +1,1064 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/jakubbortlik/chirpy/internal/search"
+)
+
+var (
+	errDuplicateEmail  error = uniqueViolation(UsersEmailKey)
+	errDuplicateToken  error = uniqueViolation("refresh_tokens_pkey")
+	errDuplicateHandle error = uniqueViolation(UsersHandleKey)
+	errUnknownUser           = errors.New("insert violates foreign key constraint: user does not exist")
+	errUnknownChirp          = errors.New("insert violates foreign key constraint: chirp does not exist")
+	errDuplicateShare  error = uniqueViolation(ChirpsRechirpKey)
+	errRechirpCheck          = errors.New("new row violates check constraint \"chirps_rechirp_check\"")
+	errFollowSelfCheck       = errors.New("new row violates check constraint \"follows_self_check\"")
+)
+
+// uniqueViolation is the error Memory returns for a duplicate in the unique
+// constraint or index it names, worded like the one from Postgres.
+type uniqueViolation string
+
+func (e uniqueViolation) Error() string {
+	return fmt.Sprintf("duplicate key value violates unique constraint %q", string(e))
+}
+
+// Memory is a Store that keeps everything in maps guarded by a mutex. It
+// mirrors the constraints of the Postgres schema (unique emails, foreign keys
+// with ON DELETE CASCADE) closely enough for the handlers not to notice.
+type Memory struct {
+	mu            sync.RWMutex
+	lastTime      time.Time
+	users         map[uuid.UUID]database.User
+	chirps        map[uuid.UUID]database.Chirp
+	revisions     map[uuid.UUID][]database.ChirpRevision
+	likes         map[likeKey]database.ChirpLike
+	tags          map[string]database.Tag
+	chirpTags     map[chirpTagKey]database.ChirpTag
+	mentions      map[mentionKey]database.ChirpMention
+	follows       map[followKey]database.Follow
+	refreshTokens map[string]database.RefreshToken
+	throttles     map[string]database.LoginThrottle
+	loginEvents   []database.LoginEvent
+}
+
+var _ Store = (*Memory)(nil)
+
+// likeKey is the primary key of chirp_likes.
+type likeKey struct {
+	chirpID, userID uuid.UUID
+}
+
+// chirpTagKey is the primary key of chirp_tags.
+type chirpTagKey struct {
+	chirpID, tagID uuid.UUID
+}
+
+// mentionKey is the primary key of chirp_mentions.
+type mentionKey struct {
+	chirpID, userID uuid.UUID
+}
+
+// followKey is the primary key of follows.
+type followKey struct {
+	followerID, followeeID uuid.UUID
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:         map[uuid.UUID]database.User{},
+		chirps:        map[uuid.UUID]database.Chirp{},
+		revisions:     map[uuid.UUID][]database.ChirpRevision{},
+		likes:         map[likeKey]database.ChirpLike{},
+		tags:          map[string]database.Tag{},
+		chirpTags:     map[chirpTagKey]database.ChirpTag{},
+		mentions:      map[mentionKey]database.ChirpMention{},
+		follows:       map[followKey]database.Follow{},
+		refreshTokens: map[string]database.RefreshToken{},
+		throttles:     map[string]database.LoginThrottle{},
+	}
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// InTx runs fn against a copy of m and keeps the copy only if fn succeeds.
+// m stays locked meanwhile, so transactions see no concurrent changes.
+func (m *Memory) InTx(ctx context.Context, fn func(Store) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx := &Memory{
+		lastTime:      m.lastTime,
+		users:         maps.Clone(m.users),
+		chirps:        maps.Clone(m.chirps),
+		revisions:     maps.Clone(m.revisions),
+		likes:         maps.Clone(m.likes),
+		tags:          maps.Clone(m.tags),
+		chirpTags:     maps.Clone(m.chirpTags),
+		mentions:      maps.Clone(m.mentions),
+		follows:       maps.Clone(m.follows),
+		refreshTokens: maps.Clone(m.refreshTokens),
+		throttles:     maps.Clone(m.throttles),
+		loginEvents:   slices.Clone(m.loginEvents),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	m.lastTime = tx.lastTime
+	m.users = tx.users
+	m.chirps = tx.chirps
+	m.revisions = tx.revisions
+	m.likes = tx.likes
+	m.tags = tx.tags
+	m.chirpTags = tx.chirpTags
+	m.mentions = tx.mentions
+	m.follows = tx.follows
+	m.refreshTokens = tx.refreshTokens
+	m.throttles = tx.throttles
+	m.loginEvents = tx.loginEvents
+	return nil
+}
+
+// now returns the current time at the precision of a Postgres timestamp
+// column. Consecutive calls never return the same instant, so that rows
+// created in quick succession still sort in creation order. It must be called
+// with m.mu held for writing.
+func (m *Memory) now() time.Time {
+	t := time.Now().UTC().Truncate(time.Microsecond)
+	if !t.After(m.lastTime) {
+		t = m.lastTime.Add(time.Microsecond)
+	}
+	m.lastTime = t
+	return t
+}
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.Chirp{}, errUnknownUser
+	}
+	if arg.RechirpOf.Valid && (arg.Body != "" || arg.QuoteOf.Valid || arg.ParentID.Valid) {
+		return database.Chirp{}, errRechirpCheck
+	}
+	for _, ref := range []uuid.NullUUID{arg.ParentID, arg.RechirpOf, arg.QuoteOf} {
+		if _, ok := m.chirps[ref.UUID]; ref.Valid && !ok {
+			return database.Chirp{}, errUnknownChirp
+		}
+	}
+	if arg.RechirpOf.Valid {
+		for _, chirp := range m.chirps {
+			if chirp.UserID == arg.UserID && chirp.RechirpOf == arg.RechirpOf {
+				return database.Chirp{}, errDuplicateShare
+			}
+		}
+	}
+	m.updateChirp(arg.ParentID, func(parent *database.Chirp) { parent.ReplyCount++ })
+	m.updateChirp(arg.RechirpOf, func(original *database.Chirp) { original.RechirpCount++ })
+	m.updateChirp(arg.QuoteOf, func(quoted *database.Chirp) { quoted.QuoteCount++ })
+	t := m.now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		ParentID:  arg.ParentID,
+		IsReply:   arg.ParentID.Valid,
+		RechirpOf: arg.RechirpOf,
+		QuoteOf:   arg.QuoteOf,
+		IsQuote:   arg.QuoteOf.Valid,
+	}
+	m.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	chirp, ok := m.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (m *Memory) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var chirps []database.Chirp
+	for _, chirp := range m.chirps {
+		if slices.Contains(ids, chirp.ID) {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return chirps, nil
+}
+
+func (m *Memory) GetRechirp(ctx context.Context, arg database.GetRechirpParams) (database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, chirp := range m.chirps {
+		if chirp.UserID == arg.UserID && chirp.RechirpOf == arg.RechirpOf {
+			return chirp, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func (m *Memory) CountUserChirps(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var n int64
+	for _, chirp := range m.chirps {
+		if chirp.UserID == userID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) ListChirps(ctx context.Context, arg database.ListChirpsParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	chirps := m.filterChirps(arg)
+	slices.SortFunc(chirps, compareChirps)
+	return page(chirps, arg.Limit, 0), nil
+}
+
+func (m *Memory) ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	chirps := m.filterChirps(database.ListChirpsParams(arg))
+	slices.SortFunc(chirps, func(a, b database.Chirp) int { return compareChirps(b, a) })
+	return page(chirps, arg.Limit, 0), nil
+}
+
+// filterChirps applies the WHERE clause shared by ListChirps and
+// ListChirpsDesc. The caller must hold m.mu.
+func (m *Memory) filterChirps(arg database.ListChirpsParams) []database.Chirp {
+	after := database.Chirp{CreatedAt: arg.AfterCreatedAt.Time, ID: arg.AfterID.UUID}
+	before := database.Chirp{CreatedAt: arg.BeforeCreatedAt.Time, ID: arg.BeforeID.UUID}
+	var chirps []database.Chirp
+	for _, chirp := range m.chirps {
+		switch {
+		case len(arg.AuthorIds) > 0 && !slices.Contains(arg.AuthorIds, chirp.UserID),
+			arg.Since.Valid && chirp.CreatedAt.Before(arg.Since.Time),
+			arg.Until.Valid && !chirp.CreatedAt.Before(arg.Until.Time),
+			arg.AfterCreatedAt.Valid && compareChirps(chirp, after) <= 0,
+			arg.BeforeCreatedAt.Valid && compareChirps(chirp, before) >= 0:
+			continue
+		}
+		chirps = append(chirps, chirp)
+	}
+	return chirps
+}
+
+// SearchChirps ranks chirps with search.Match, a simpler cousin of the
+// Postgres text search that neither stems words nor drops stop words.
+func (m *Memory) SearchChirps(ctx context.Context, arg database.SearchChirpsParams) ([]database.SearchChirpsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var rows []database.SearchChirpsRow
+	for _, chirp := range m.chirps {
+		if len(arg.AuthorIds) > 0 && !slices.Contains(arg.AuthorIds, chirp.UserID) {
+			continue
+		}
+		rank, ok := search.Match(arg.Query, chirp.Body)
+		if !ok {
+			continue
+		}
+		row := database.SearchChirpsRow{Chirp: chirp, Rank: rank}
+		if arg.BeforeRank.Valid && compareSearchRows(row, database.SearchChirpsRow{
+			Chirp: database.Chirp{CreatedAt: arg.BeforeCreatedAt.Time, ID: arg.BeforeID.UUID},
+			Rank:  float32(arg.BeforeRank.Float64),
+		}) >= 0 {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	slices.SortFunc(rows, func(a, b database.SearchChirpsRow) int { return compareSearchRows(b, a) })
+	return page(rows, arg.Limit, 0), nil
+}
+
+func (m *Memory) SearchChirpsRecent(ctx context.Context, arg database.SearchChirpsRecentParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	chirps := m.filterChirps(database.ListChirpsParams{
+		AuthorIds:       arg.AuthorIds,
+		BeforeCreatedAt: arg.BeforeCreatedAt,
+		BeforeID:        arg.BeforeID,
+	})
+	chirps = slices.DeleteFunc(chirps, func(chirp database.Chirp) bool {
+		_, ok := search.Match(arg.Query, chirp.Body)
+		return !ok
+	})
+	slices.SortFunc(chirps, func(a, b database.Chirp) int { return compareChirps(b, a) })
+	return page(chirps, arg.Limit, 0), nil
+}
+
+func (m *Memory) UpdateChirp(ctx context.Context, arg database.UpdateChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[arg.ID]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	t := m.now()
+	m.revisions[chirp.ID] = append(m.revisions[chirp.ID], database.ChirpRevision{
+		ID:         uuid.New(),
+		ChirpID:    chirp.ID,
+		Body:       chirp.Body,
+		CreatedAt:  chirp.UpdatedAt,
+		ReplacedAt: t,
+	})
+	chirp.Body = arg.Body
+	chirp.UpdatedAt = t
+	m.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteChirp(id)
+	return nil
+}
+
+// deleteChirp deletes a chirp with everything that goes with it: its
+// revisions, likes, tags, mentions and rechirps. Replies and quotes stay but lose their
+// reference. The caller must hold m.mu for writing.
+func (m *Memory) deleteChirp(id uuid.UUID) {
+	chirp, ok := m.chirps[id]
+	if !ok {
+		return
+	}
+	delete(m.chirps, id)
+	m.updateChirp(chirp.ParentID, func(parent *database.Chirp) { parent.ReplyCount-- })
+	m.updateChirp(chirp.RechirpOf, func(original *database.Chirp) { original.RechirpCount-- })
+	m.updateChirp(chirp.QuoteOf, func(quoted *database.Chirp) { quoted.QuoteCount-- })
+	for _, other := range m.chirps {
+		if other.RechirpOf.Valid && other.RechirpOf.UUID == id {
+			m.deleteChirp(other.ID)
+			continue
+		}
+		// A reply may also quote the chirp it replies to.
+		if other.ParentID.Valid && other.ParentID.UUID == id {
+			other.ParentID = uuid.NullUUID{}
+			m.chirps[other.ID] = other
+		}
+		if other.QuoteOf.Valid && other.QuoteOf.UUID == id {
+			other.QuoteOf = uuid.NullUUID{}
+			m.chirps[other.ID] = other
+		}
+	}
+	delete(m.revisions, id)
+	for key := range m.likes {
+		if key.chirpID == id {
+			delete(m.likes, key)
+		}
+	}
+	for key := range m.chirpTags {
+		if key.chirpID == id {
+			delete(m.chirpTags, key)
+		}
+	}
+	for key := range m.mentions {
+		if key.chirpID == id {
+			delete(m.mentions, key)
+		}
+	}
+}
+
+// updateChirp applies update to the chirp id refers to, like the triggers
+// that keep the counts on chirps current. It does nothing if id is null or
+// the chirp is gone. The caller must hold m.mu for writing.
+func (m *Memory) updateChirp(id uuid.NullUUID, update func(*database.Chirp)) {
+	chirp, ok := m.chirps[id.UUID]
+	if !id.Valid || !ok {
+		return
+	}
+	update(&chirp)
+	m.chirps[chirp.ID] = chirp
+}
+
+func (m *Memory) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var ancestors []database.Chirp
+	chirp, ok := m.chirps[id]
+	for ok && chirp.ParentID.Valid {
+		chirp, ok = m.chirps[chirp.ParentID.UUID]
+		if ok {
+			ancestors = append(ancestors, chirp)
+		}
+	}
+	slices.Reverse(ancestors)
+	return ancestors, nil
+}
+
+func (m *Memory) GetChirpDescendants(ctx context.Context, arg database.GetChirpDescendantsParams) ([]database.GetChirpDescendantsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	replies := map[uuid.UUID][]database.Chirp{}
+	for _, chirp := range m.chirps {
+		if chirp.ParentID.Valid {
+			replies[chirp.ParentID.UUID] = append(replies[chirp.ParentID.UUID], chirp)
+		}
+	}
+	var rows []database.GetChirpDescendantsRow
+	var walk func(parent uuid.UUID, path []string)
+	walk = func(parent uuid.UUID, path []string) {
+		for _, chirp := range replies[parent] {
+			path := append(slices.Clip(path), threadPathElement(chirp))
+			if len(arg.AfterPath) == 0 || slices.Compare(path, arg.AfterPath) > 0 {
+				rows = append(rows, database.GetChirpDescendantsRow{Chirp: chirp, Depth: int32(len(path)), Path: path})
+			}
+			walk(chirp.ID, path)
+		}
+	}
+	walk(arg.ID, nil)
+	slices.SortFunc(rows, func(a, b database.GetChirpDescendantsRow) int { return slices.Compare(a.Path, b.Path) })
+	return page(rows, arg.Limit, 0), nil
+}
+
+// threadPathElement is the element GetChirpDescendants adds to the path of
+// a reply: its creation time as formatted by to_char with
+// 'YYYYMMDDHH24MISSUS', followed by its ID.
+func threadPathElement(chirp database.Chirp) string {
+	t := chirp.CreatedAt.UTC()
+	return fmt.Sprintf("%s%06d%s", t.Format("20060102150405"), t.Nanosecond()/1000, chirp.ID)
+}
+
+func (m *Memory) GetChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.revisions[chirpID]), nil
+}
+
+func (m *Memory) LikeChirp(ctx context.Context, arg database.LikeChirpParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[arg.ChirpID]
+	if !ok {
+		return errUnknownChirp
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return errUnknownUser
+	}
+	key := likeKey{chirpID: arg.ChirpID, userID: arg.UserID}
+	if _, ok := m.likes[key]; ok {
+		return nil
+	}
+	m.likes[key] = database.ChirpLike{ChirpID: arg.ChirpID, UserID: arg.UserID, CreatedAt: m.now()}
+	chirp.LikeCount++
+	m.chirps[chirp.ID] = chirp
+	return nil
+}
+
+func (m *Memory) UnlikeChirp(ctx context.Context, arg database.UnlikeChirpParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := likeKey{chirpID: arg.ChirpID, userID: arg.UserID}
+	if _, ok := m.likes[key]; !ok {
+		return nil
+	}
+	delete(m.likes, key)
+	if chirp, ok := m.chirps[arg.ChirpID]; ok {
+		chirp.LikeCount--
+		m.chirps[chirp.ID] = chirp
+	}
+	return nil
+}
+
+func (m *Memory) GetLikedChirpIDs(ctx context.Context, arg database.GetLikedChirpIDsParams) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var ids []uuid.UUID
+	for _, id := range arg.ChirpIds {
+		if _, ok := m.likes[likeKey{chirpID: id, userID: arg.UserID}]; ok && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) ListLikedChirps(ctx context.Context, arg database.ListLikedChirpsParams) ([]database.ListLikedChirpsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	before := database.Chirp{CreatedAt: arg.BeforeLikedAt.Time, ID: arg.BeforeID.UUID}
+	var rows []database.ListLikedChirpsRow
+	for key, like := range m.likes {
+		if key.userID != arg.UserID {
+			continue
+		}
+		if arg.BeforeLikedAt.Valid && compareChirps(database.Chirp{CreatedAt: like.CreatedAt, ID: like.ChirpID}, before) >= 0 {
+			continue
+		}
+		rows = append(rows, database.ListLikedChirpsRow{Chirp: m.chirps[key.chirpID], LikedAt: like.CreatedAt})
+	}
+	slices.SortFunc(rows, func(a, b database.ListLikedChirpsRow) int {
+		return compareChirps(database.Chirp{CreatedAt: b.LikedAt, ID: b.Chirp.ID}, database.Chirp{CreatedAt: a.LikedAt, ID: a.Chirp.ID})
+	})
+	return page(rows, arg.Limit, 0), nil
+}
+
+func (m *Memory) SetChirpTags(ctx context.Context, arg database.SetChirpTagsParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[arg.ChirpID]
+	if !ok {
+		return nil
+	}
+	keep := map[chirpTagKey]bool{}
+	for _, name := range arg.Names {
+		tag, ok := m.tags[name]
+		if !ok {
+			tag = database.Tag{ID: uuid.New(), Name: name, CreatedAt: m.now()}
+			m.tags[name] = tag
+		}
+		key := chirpTagKey{chirpID: chirp.ID, tagID: tag.ID}
+		keep[key] = true
+		if _, ok := m.chirpTags[key]; !ok {
+			m.chirpTags[key] = database.ChirpTag{ChirpID: chirp.ID, TagID: tag.ID, CreatedAt: chirp.CreatedAt}
+		}
+	}
+	for key := range m.chirpTags {
+		if key.chirpID == chirp.ID && !keep[key] {
+			delete(m.chirpTags, key)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetChirpTags(ctx context.Context, chirpIds []uuid.UUID) ([]database.GetChirpTagsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := m.tagNames()
+	var rows []database.GetChirpTagsRow
+	for key := range m.chirpTags {
+		if slices.Contains(chirpIds, key.chirpID) {
+			rows = append(rows, database.GetChirpTagsRow{ChirpID: key.chirpID, Name: names[key.tagID]})
+		}
+	}
+	slices.SortFunc(rows, func(a, b database.GetChirpTagsRow) int { return strings.Compare(a.Name, b.Name) })
+	return rows, nil
+}
+
+func (m *Memory) ListTagChirps(ctx context.Context, arg database.ListTagChirpsParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tag, ok := m.tags[arg.Tag]
+	if !ok {
+		return nil, nil
+	}
+	before := database.Chirp{CreatedAt: arg.BeforeCreatedAt.Time, ID: arg.BeforeID.UUID}
+	var chirps []database.Chirp
+	for key := range m.chirpTags {
+		chirp := m.chirps[key.chirpID]
+		if key.tagID != tag.ID || arg.BeforeCreatedAt.Valid && compareChirps(chirp, before) >= 0 {
+			continue
+		}
+		chirps = append(chirps, chirp)
+	}
+	slices.SortFunc(chirps, func(a, b database.Chirp) int { return compareChirps(b, a) })
+	return page(chirps, arg.Limit, 0), nil
+}
+
+func (m *Memory) TrendingTags(ctx context.Context, arg database.TrendingTagsParams) ([]database.TrendingTagsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := m.tagNames()
+	counts := map[string]int64{}
+	for key, chirpTag := range m.chirpTags {
+		if !chirpTag.CreatedAt.Before(arg.Since) {
+			counts[names[key.tagID]]++
+		}
+	}
+	rows := make([]database.TrendingTagsRow, 0, len(counts))
+	for name, count := range counts {
+		rows = append(rows, database.TrendingTagsRow{Name: name, ChirpCount: count})
+	}
+	slices.SortFunc(rows, func(a, b database.TrendingTagsRow) int {
+		if c := cmp.Compare(b.ChirpCount, a.ChirpCount); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return page(rows, arg.Limit, 0), nil
+}
+
+// tagNames maps the IDs of tags to their names. The caller must hold m.mu.
+func (m *Memory) tagNames() map[uuid.UUID]string {
+	names := make(map[uuid.UUID]string, len(m.tags))
+	for name, tag := range m.tags {
+		names[tag.ID] = name
+	}
+	return names
+}
+
+func (m *Memory) SetChirpMentions(ctx context.Context, arg database.SetChirpMentionsParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[arg.ChirpID]
+	if !ok {
+		return nil
+	}
+	keep := map[mentionKey]bool{}
+	for _, handle := range arg.Handles {
+		user, ok := m.userByHandle(handle)
+		if !ok {
+			continue
+		}
+		key := mentionKey{chirpID: chirp.ID, userID: user.ID}
+		keep[key] = true
+		m.mentions[key] = database.ChirpMention{
+			ChirpID:   chirp.ID,
+			UserID:    user.ID,
+			Handle:    user.Handle.String,
+			CreatedAt: chirp.CreatedAt,
+		}
+	}
+	for key := range m.mentions {
+		if key.chirpID == chirp.ID && !keep[key] {
+			delete(m.mentions, key)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetChirpMentions(ctx context.Context, chirpIds []uuid.UUID) ([]database.GetChirpMentionsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var rows []database.GetChirpMentionsRow
+	for key, mention := range m.mentions {
+		if slices.Contains(chirpIds, key.chirpID) {
+			rows = append(rows, database.GetChirpMentionsRow{ChirpID: key.chirpID, UserID: key.userID, Handle: mention.Handle})
+		}
+	}
+	return rows, nil
+}
+
+func (m *Memory) ListMentions(ctx context.Context, arg database.ListMentionsParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	before := database.Chirp{CreatedAt: arg.BeforeCreatedAt.Time, ID: arg.BeforeID.UUID}
+	var chirps []database.Chirp
+	for key := range m.mentions {
+		chirp := m.chirps[key.chirpID]
+		if key.userID != arg.UserID || arg.BeforeCreatedAt.Valid && compareChirps(chirp, before) >= 0 {
+			continue
+		}
+		chirps = append(chirps, chirp)
+	}
+	slices.SortFunc(chirps, func(a, b database.Chirp) int { return compareChirps(b, a) })
+	return page(chirps, arg.Limit, 0), nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.userByEmail(arg.Email); ok {
+		return database.User{}, errDuplicateEmail
+	}
+	t := m.now()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      t,
+		UpdatedAt:      t,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+	}
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, email string) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.userByEmail(email)
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *Memory) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *Memory) GetUserByHandle(ctx context.Context, handle string) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.userByHandle(handle)
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *Memory) GetUserHandles(ctx context.Context, ids []uuid.UUID) ([]database.GetUserHandlesRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var rows []database.GetUserHandlesRow
+	for _, id := range ids {
+		if user, ok := m.users[id]; ok {
+			rows = append(rows, database.GetUserHandlesRow{ID: user.ID, Handle: user.Handle})
+		}
+	}
+	return rows, nil
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	if other, ok := m.userByEmail(arg.Email); ok && other.ID != arg.ID {
+		return database.User{}, errDuplicateEmail
+	}
+	if other, ok := m.userByHandle(arg.Handle.String); arg.Handle.Valid && ok && other.ID != arg.ID {
+		return database.User{}, errDuplicateHandle
+	}
+	user.Email = arg.Email
+	user.HashedPassword = arg.HashedPassword
+	if arg.Handle.Valid {
+		user.Handle = arg.Handle
+	}
+	for _, f := range []struct {
+		dst *string
+		src sql.NullString
+	}{
+		{&user.DisplayName, arg.DisplayName},
+		{&user.Bio, arg.Bio},
+		{&user.Website, arg.Website},
+		{&user.AvatarUrl, arg.AvatarUrl},
+	} {
+		if f.src.Valid {
+			*f.dst = f.src.String
+		}
+	}
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) UpgradeUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.IsChirpyRed = true
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) SetChirpyRed(ctx context.Context, arg database.SetChirpyRedParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.IsChirpyRed = arg.IsChirpyRed
+	user.UpdatedAt = m.now()
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) SetUserAdmin(ctx context.Context, arg database.SetUserAdminParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.userByEmail(arg.Email)
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.IsAdmin = arg.IsAdmin
+	user.UpdatedAt = m.now()
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) ListUsers(ctx context.Context, arg database.ListUsersParams) ([]database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	query := strings.ToLower(arg.Query)
+	var users []database.User
+	for _, user := range m.users {
+		if strings.Contains(strings.ToLower(user.Email), query) {
+			users = append(users, user)
+		}
+	}
+	slices.SortFunc(users, func(a, b database.User) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return page(users, arg.Limit, arg.Offset), nil
+}
+
+func (m *Memory) DeleteUsers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.users)
+	clear(m.chirps)
+	clear(m.revisions)
+	clear(m.likes)
+	clear(m.chirpTags)
+	clear(m.mentions)
+	clear(m.follows)
+	clear(m.refreshTokens)
+	for i := range m.loginEvents {
+		m.loginEvents[i].UserID = uuid.NullUUID{}
+	}
+	return nil
+}
+
+func (m *Memory) FollowUser(ctx context.Context, arg database.FollowUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range []uuid.UUID{arg.FollowerID, arg.FolloweeID} {
+		if _, ok := m.users[id]; !ok {
+			return errUnknownUser
+		}
+	}
+	if arg.FollowerID == arg.FolloweeID {
+		return errFollowSelfCheck
+	}
+	key := followKey{followerID: arg.FollowerID, followeeID: arg.FolloweeID}
+	if _, ok := m.follows[key]; ok {
+		return nil
+	}
+	m.follows[key] = database.Follow{FollowerID: arg.FollowerID, FolloweeID: arg.FolloweeID, CreatedAt: m.now()}
+	return nil
+}
+
+func (m *Memory) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.follows, followKey{followerID: arg.FollowerID, followeeID: arg.FolloweeID})
+	return nil
+}
+
+func (m *Memory) CountFollowers(ctx context.Context, followeeID uuid.UUID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var n int64
+	for key := range m.follows {
+		if key.followeeID == followeeID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return errUnknownUser
+	}
+	if _, ok := m.refreshTokens[arg.Token]; ok {
+		return errDuplicateToken
+	}
+	t := m.now()
+	m.refreshTokens[arg.Token] = database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: t,
+		UpdatedAt: t,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	return nil
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	refreshToken, ok := m.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return refreshToken, nil
+}
+
+func (m *Memory) GetRefreshTokensForUser(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var tokens []database.RefreshToken
+	for _, token := range m.refreshTokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	slices.SortFunc(tokens, func(a, b database.RefreshToken) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (m *Memory) GetUserFromRefreshToken(ctx context.Context, token string) (uuid.UUID, error) {
+	refreshToken, err := m.GetRefreshToken(ctx, token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return refreshToken.UserID, nil
+}
+
+func (m *Memory) RevokeRefreshToken(ctx context.Context, arg database.RevokeRefreshTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	refreshToken, ok := m.refreshTokens[arg.Token]
+	if !ok {
+		return nil
+	}
+	refreshToken.UpdatedAt = arg.UpdatedAt
+	refreshToken.RevokedAt = sql.NullTime{Time: arg.UpdatedAt, Valid: true}
+	m.refreshTokens[arg.Token] = refreshToken
+	return nil
+}
+
+func (m *Memory) GetLoginThrottle(ctx context.Context, key string) (database.LoginThrottle, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	throttle, ok := m.throttles[key]
+	if !ok {
+		return database.LoginThrottle{}, sql.ErrNoRows
+	}
+	return throttle, nil
+}
+
+func (m *Memory) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	throttle, ok := m.throttles[arg.Key]
+	if !ok {
+		throttle = database.LoginThrottle{Key: arg.Key}
+	}
+	if !ok || throttle.LastFailureAt.Before(arg.WindowStart) {
+		throttle.Failures = 1
+	} else {
+		throttle.Failures++
+	}
+	throttle.LastFailureAt = arg.Now
+	m.throttles[arg.Key] = throttle
+	return throttle, nil
+}
+
+func (m *Memory) LockLoginThrottle(ctx context.Context, arg database.LockLoginThrottleParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	throttle, ok := m.throttles[arg.Key]
+	if !ok {
+		return nil
+	}
+	throttle.LockedUntil = arg.LockedUntil
+	m.throttles[arg.Key] = throttle
+	return nil
+}
+
+func (m *Memory) DeleteLoginThrottle(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.throttles, key)
+	return nil
+}
+
+func (m *Memory) DeleteIdleLoginThrottles(ctx context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, throttle := range m.throttles {
+		locked := throttle.LockedUntil.Valid && !throttle.LockedUntil.Time.Before(before)
+		if throttle.LastFailureAt.Before(before) && !locked {
+			delete(m.throttles, key)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CreateLoginEvent(ctx context.Context, arg database.CreateLoginEventParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if arg.UserID.Valid {
+		if _, ok := m.users[arg.UserID.UUID]; !ok {
+			return errUnknownUser
+		}
+	}
+	m.loginEvents = append(m.loginEvents, database.LoginEvent{
+		ID:        uuid.New(),
+		CreatedAt: m.now(),
+		Email:     arg.Email,
+		UserID:    arg.UserID,
+		Ip:        arg.Ip,
+		Event:     arg.Event,
+	})
+	return nil
+}
+
+// userByEmail must be called with m.mu held.
+func (m *Memory) userByEmail(email string) (database.User, bool) {
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, true
+		}
+	}
+	return database.User{}, false
+}
+
+// userByHandle finds a user by handle regardless of case. The caller must
+// hold m.mu.
+func (m *Memory) userByHandle(handle string) (database.User, bool) {
+	for _, user := range m.users {
+		if user.Handle.Valid && strings.EqualFold(user.Handle.String, handle) {
+			return user, true
+		}
+	}
+	return database.User{}, false
+}
+
+// compareChirps orders chirps the way the Postgres queries do.
+func compareChirps(a, b database.Chirp) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return slices.Compare(a.ID[:], b.ID[:])
+}
+
+// compareSearchRows orders search results by (rank, created_at, id).
+func compareSearchRows(a, b database.SearchChirpsRow) int {
+	if c := cmp.Compare(a.Rank, b.Rank); c != 0 {
+		return c
+	}
+	return compareChirps(a.Chirp, b.Chirp)
+}
+
+// page applies LIMIT and OFFSET to items.
+func page[T any](items []T, limit, offset int32) []T {
+	start := min(int(offset), len(items))
+	end := min(start+int(limit), len(items))
+	return items[start:end]
+}
@@ -0,0 +1,160 @@
+// Package store defines the persistence interface used by the HTTP handlers
+// together with a Postgres implementation backed by the sqlc-generated
+// queries and a concurrency-safe in-memory implementation.
+//
+// All implementations report a missing row with sql.ErrNoRows, exactly like
+// database/sql, and a duplicate in a unique column with an error that
+// IsUniqueViolation recognises, so callers can treat them interchangeably.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	"github.com/lib/pq"
+)
+
+// Unique constraints and indexes that callers tell apart with
+// IsUniqueViolation.
+const (
+	UsersEmailKey    = "users_email_key"
+	UsersHandleKey   = "users_handle_key"
+	ChirpsRechirpKey = "chirps_user_id_rechirp_of_idx"
+)
+
+// IsUniqueViolation reports whether err is the violation of the unique
+// constraint or index named constraint.
+func IsUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505" && pqErr.Constraint == constraint
+	}
+	var memErr uniqueViolation
+	return errors.As(err, &memErr) && string(memErr) == constraint
+}
+
+type Store interface {
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	CountUserChirps(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.Chirp, error)
+	GetChirpDescendants(ctx context.Context, arg database.GetChirpDescendantsParams) ([]database.GetChirpDescendantsRow, error)
+	GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]database.Chirp, error)
+	GetRechirp(ctx context.Context, arg database.GetRechirpParams) (database.Chirp, error)
+	ListChirps(ctx context.Context, arg database.ListChirpsParams) ([]database.Chirp, error)
+	ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error)
+	SearchChirps(ctx context.Context, arg database.SearchChirpsParams) ([]database.SearchChirpsRow, error)
+	SearchChirpsRecent(ctx context.Context, arg database.SearchChirpsRecentParams) ([]database.Chirp, error)
+	UpdateChirp(ctx context.Context, arg database.UpdateChirpParams) (database.Chirp, error)
+	DeleteChirp(ctx context.Context, id uuid.UUID) error
+	GetChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error)
+
+	LikeChirp(ctx context.Context, arg database.LikeChirpParams) error
+	UnlikeChirp(ctx context.Context, arg database.UnlikeChirpParams) error
+	GetLikedChirpIDs(ctx context.Context, arg database.GetLikedChirpIDsParams) ([]uuid.UUID, error)
+	ListLikedChirps(ctx context.Context, arg database.ListLikedChirpsParams) ([]database.ListLikedChirpsRow, error)
+
+	SetChirpTags(ctx context.Context, arg database.SetChirpTagsParams) error
+	GetChirpTags(ctx context.Context, chirpIds []uuid.UUID) ([]database.GetChirpTagsRow, error)
+	ListTagChirps(ctx context.Context, arg database.ListTagChirpsParams) ([]database.Chirp, error)
+	TrendingTags(ctx context.Context, arg database.TrendingTagsParams) ([]database.TrendingTagsRow, error)
+
+	SetChirpMentions(ctx context.Context, arg database.SetChirpMentionsParams) error
+	GetChirpMentions(ctx context.Context, chirpIds []uuid.UUID) ([]database.GetChirpMentionsRow, error)
+	ListMentions(ctx context.Context, arg database.ListMentionsParams) ([]database.Chirp, error)
+
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error)
+	GetUser(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetUserByHandle(ctx context.Context, handle string) (database.User, error)
+	GetUserHandles(ctx context.Context, ids []uuid.UUID) ([]database.GetUserHandlesRow, error)
+	UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error)
+	UpgradeUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	SetChirpyRed(ctx context.Context, arg database.SetChirpyRedParams) (database.User, error)
+	SetUserAdmin(ctx context.Context, arg database.SetUserAdminParams) (database.User, error)
+	ListUsers(ctx context.Context, arg database.ListUsersParams) ([]database.User, error)
+	DeleteUsers(ctx context.Context) error
+
+	FollowUser(ctx context.Context, arg database.FollowUserParams) error
+	UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error
+	CountFollowers(ctx context.Context, followeeID uuid.UUID) (int64, error)
+
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error
+	GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	GetRefreshTokensForUser(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error)
+	GetUserFromRefreshToken(ctx context.Context, token string) (uuid.UUID, error)
+	RevokeRefreshToken(ctx context.Context, arg database.RevokeRefreshTokenParams) error
+
+	GetLoginThrottle(ctx context.Context, key string) (database.LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginThrottle, error)
+	LockLoginThrottle(ctx context.Context, arg database.LockLoginThrottleParams) error
+	DeleteLoginThrottle(ctx context.Context, key string) error
+	DeleteIdleLoginThrottles(ctx context.Context, before time.Time) error
+	CreateLoginEvent(ctx context.Context, arg database.CreateLoginEventParams) error
+
+	// InTx calls fn with a Store whose changes are committed together if fn
+	// returns nil and discarded if it returns an error, which InTx returns.
+	// fn must use only the Store it is given.
+	InTx(ctx context.Context, fn func(Store) error) error
+
+	Close() error
+}
+
+// Postgres is the production Store. The queries themselves are generated by
+// sqlc from sql/queries; Postgres only adds ownership of the pool.
+type Postgres struct {
+	*database.Queries
+	db      *sql.DB
+	tx      *sql.Tx
+	observe QueryObserver
+}
+
+var _ Store = (*Postgres)(nil)
+
+// NewPostgres returns a Store using db. If observe is not nil it is called
+// after every query with its duration.
+func NewPostgres(db *sql.DB, observe QueryObserver) *Postgres {
+	return &Postgres{
+		Queries: database.New(instrument(db, observe)),
+		db:      db,
+		observe: observe,
+	}
+}
+
+func instrument(db database.DBTX, observe QueryObserver) database.DBTX {
+	if observe == nil {
+		return db
+	}
+	return instrumentedDB{db: db, observe: observe}
+}
+
+// InTx runs fn in a database transaction. Called on a Store that is already
+// in a transaction, it runs fn in that one.
+func (p *Postgres) InTx(ctx context.Context, fn func(Store) error) error {
+	if p.tx != nil {
+		return fn(p)
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = fn(&Postgres{
+		Queries: database.New(instrument(tx, p.observe)),
+		db:      p.db,
+		tx:      tx,
+		observe: p.observe,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) Close() error {
+	return p.db.Close()
+}
@@ -0,0 +1,1203 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/database"
+	_ "github.com/lib/pq"
+)
+
+func TestMemory(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		return NewMemory()
+	})
+}
+
+// TestPostgres runs the conformance suite against a real, already migrated
+// database. It is skipped unless CHIRPY_TEST_DB_URL is set; the database is
+// wiped before every subtest.
+func TestPostgres(t *testing.T) {
+	dbURL := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("CHIRPY_TEST_DB_URL not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	testStore(t, func(t *testing.T) Store {
+		s := &Postgres{Queries: database.New(db), db: db}
+		if err := s.DeleteUsers(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s Store)
+	}{
+		{"Users", testUsers},
+		{"UserHandles", testUserHandles},
+		{"UserProfiles", testUserProfiles},
+		{"Chirps", testChirps},
+		{"Transactions", testTransactions},
+		{"ListChirps", testListChirps},
+		{"SearchChirps", testSearchChirps},
+		{"ChirpRevisions", testChirpRevisions},
+		{"ChirpReplies", testChirpReplies},
+		{"ChirpLikes", testChirpLikes},
+		{"Rechirps", testRechirps},
+		{"ChirpTags", testChirpTags},
+		{"ChirpMentions", testChirpMentions},
+		{"Follows", testFollows},
+		{"RefreshTokens", testRefreshTokens},
+		{"DeleteUsersCascades", testDeleteUsersCascades},
+		{"LoginThrottles", testLoginThrottles},
+		{"Admin", testAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+func mustCreateUser(t *testing.T, s Store, email string) database.User {
+	t.Helper()
+	user, err := s.CreateUser(context.Background(), database.CreateUserParams{
+		Email:          email,
+		HashedPassword: "hash",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser(%q) error = %v", email, err)
+	}
+	return user
+}
+
+func mustCreateChirp(t *testing.T, s Store, userID uuid.UUID, body string) database.Chirp {
+	t.Helper()
+	chirp, err := s.CreateChirp(context.Background(), database.CreateChirpParams{
+		Body:   body,
+		UserID: userID,
+	})
+	if err != nil {
+		t.Fatalf("CreateChirp(%q) error = %v", body, err)
+	}
+	return chirp
+}
+
+func testUsers(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "walt@example.com")
+	if user.ID == uuid.Nil || user.CreatedAt.IsZero() || user.IsChirpyRed {
+		t.Errorf("CreateUser() returned unexpected user %+v", user)
+	}
+
+	if _, err := s.CreateUser(ctx, database.CreateUserParams{Email: user.Email, HashedPassword: "x"}); !IsUniqueViolation(err, UsersEmailKey) {
+		t.Errorf("CreateUser() with duplicate email error = %v, want a violation of %s", err, UsersEmailKey)
+	}
+
+	got, err := s.GetUser(ctx, user.Email)
+	if err != nil || got.ID != user.ID {
+		t.Errorf("GetUser() = %+v, %v; want user %s", got, err, user.ID)
+	}
+	if _, err := s.GetUser(ctx, "nobody@example.com"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUser() of unknown email error = %v, want sql.ErrNoRows", err)
+	}
+	got, err = s.GetUserByID(ctx, user.ID)
+	if err != nil || got.Email != user.Email {
+		t.Errorf("GetUserByID() = %+v, %v; want user %s", got, err, user.Email)
+	}
+	if _, err := s.GetUserByID(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserByID() of unknown user error = %v, want sql.ErrNoRows", err)
+	}
+
+	updated, err := s.UpdateUser(ctx, database.UpdateUserParams{
+		ID:             user.ID,
+		Email:          "heisenberg@example.com",
+		HashedPassword: "newhash",
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if updated.Email != "heisenberg@example.com" || updated.HashedPassword != "newhash" {
+		t.Errorf("UpdateUser() = %+v", updated)
+	}
+	other := mustCreateUser(t, s, "jesse@example.com")
+	if _, err := s.UpdateUser(ctx, database.UpdateUserParams{ID: other.ID, Email: updated.Email}); !IsUniqueViolation(err, UsersEmailKey) {
+		t.Errorf("UpdateUser() to a taken email error = %v, want a violation of %s", err, UsersEmailKey)
+	}
+	if _, err := s.UpdateUser(ctx, database.UpdateUserParams{ID: uuid.New(), Email: "x@example.com"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UpdateUser() of unknown user error = %v, want sql.ErrNoRows", err)
+	}
+
+	upgraded, err := s.UpgradeUser(ctx, user.ID)
+	if err != nil || !upgraded.IsChirpyRed {
+		t.Errorf("UpgradeUser() = %+v, %v", upgraded, err)
+	}
+	if _, err := s.UpgradeUser(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UpgradeUser() of unknown user error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testUserHandles(t *testing.T, s Store) {
+	ctx := context.Background()
+	walt := mustCreateUser(t, s, "walt@example.com")
+	jesse := mustCreateUser(t, s, "jesse@example.com")
+	setHandle := func(user database.User, handle sql.NullString) (database.User, error) {
+		return s.UpdateUser(ctx, database.UpdateUserParams{
+			ID:             user.ID,
+			Email:          user.Email,
+			HashedPassword: user.HashedPassword,
+			Handle:         handle,
+		})
+	}
+
+	if walt.Handle.Valid {
+		t.Errorf("CreateUser() handle = %q, want none", walt.Handle.String)
+	}
+	got, err := setHandle(walt, sql.NullString{String: "Heisenberg", Valid: true})
+	if err != nil || got.Handle.String != "Heisenberg" {
+		t.Fatalf("UpdateUser() with handle = %+v, %v", got, err)
+	}
+	got, err = setHandle(got, sql.NullString{})
+	if err != nil || got.Handle.String != "Heisenberg" {
+		t.Errorf("UpdateUser() without handle = %+v, %v; want handle kept", got, err)
+	}
+	if _, err := setHandle(jesse, sql.NullString{String: "heisenberg", Valid: true}); !IsUniqueViolation(err, UsersHandleKey) {
+		t.Errorf("UpdateUser() to a handle taken in another case error = %v, want a violation of %s", err, UsersHandleKey)
+	}
+
+	got, err = s.GetUserByHandle(ctx, "HEISENBERG")
+	if err != nil || got.ID != walt.ID {
+		t.Errorf("GetUserByHandle() = %+v, %v; want %s", got, err, walt.ID)
+	}
+	if _, err := s.GetUserByHandle(ctx, "pinkman"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserByHandle() of unknown handle error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testUserProfiles(t *testing.T, s Store) {
+	ctx := context.Background()
+	walt := mustCreateUser(t, s, "walt@example.com")
+	jesse := mustCreateUser(t, s, "jesse@example.com")
+	update := func(arg database.UpdateUserParams) database.User {
+		t.Helper()
+		arg.ID, arg.Email, arg.HashedPassword = walt.ID, walt.Email, walt.HashedPassword
+		user, err := s.UpdateUser(ctx, arg)
+		if err != nil {
+			t.Fatalf("UpdateUser() error = %v", err)
+		}
+		return user
+	}
+
+	got := update(database.UpdateUserParams{
+		Handle:      sql.NullString{String: "heisenberg", Valid: true},
+		DisplayName: sql.NullString{String: "Walter White", Valid: true},
+		Bio:         sql.NullString{String: "Chemistry teacher", Valid: true},
+		Website:     sql.NullString{String: "https://example.com", Valid: true},
+	})
+	if got.DisplayName != "Walter White" || got.Bio != "Chemistry teacher" || got.Website != "https://example.com" || got.AvatarUrl != "" {
+		t.Errorf("UpdateUser() = %+v", got)
+	}
+	got = update(database.UpdateUserParams{Bio: sql.NullString{Valid: true}})
+	if got.DisplayName != "Walter White" || got.Bio != "" || got.Website != "https://example.com" {
+		t.Errorf("UpdateUser() of bio alone = %+v; want bio cleared and the rest kept", got)
+	}
+
+	rows, err := s.GetUserHandles(ctx, []uuid.UUID{walt.ID, jesse.ID, uuid.New()})
+	if err != nil {
+		t.Fatalf("GetUserHandles() error = %v", err)
+	}
+	slices.SortFunc(rows, func(a, b database.GetUserHandlesRow) int { return strings.Compare(a.Handle.String, b.Handle.String) })
+	want := []database.GetUserHandlesRow{{ID: jesse.ID}, {ID: walt.ID, Handle: sql.NullString{String: "heisenberg", Valid: true}}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("GetUserHandles() = %+v, want %+v", rows, want)
+	}
+
+	mustCreateChirp(t, s, walt.ID, "first")
+	mustCreateChirp(t, s, walt.ID, "second")
+	for _, tt := range []struct {
+		user database.User
+		want int64
+	}{{walt, 2}, {jesse, 0}} {
+		if n, err := s.CountUserChirps(ctx, tt.user.ID); err != nil || n != tt.want {
+			t.Errorf("CountUserChirps(%s) = %d, %v; want %d", tt.user.Email, n, err, tt.want)
+		}
+	}
+}
+
+func testChirps(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+
+	if _, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "orphan", UserID: uuid.New()}); err == nil {
+		t.Error("CreateChirp() for unknown user should fail")
+	}
+
+	first := mustCreateChirp(t, s, alice.ID, "first")
+	second := mustCreateChirp(t, s, bob.ID, "second")
+	third := mustCreateChirp(t, s, alice.ID, "third")
+
+	got, err := s.GetChirp(ctx, second.ID)
+	if err != nil || got.Body != "second" || got.UserID != bob.ID {
+		t.Errorf("GetChirp() = %+v, %v", got, err)
+	}
+	if _, err := s.GetChirp(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetChirp() of unknown chirp error = %v, want sql.ErrNoRows", err)
+	}
+
+	assertChirpIDs(t, "ListChirps(all)", mustListChirps(t, s), first.ID, second.ID, third.ID)
+	assertChirpIDs(t, "ListChirps(alice)", mustListChirps(t, s, alice.ID), first.ID, third.ID)
+
+	if err := s.DeleteChirp(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteChirp() error = %v", err)
+	}
+	if _, err := s.GetChirp(ctx, first.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetChirp() after delete error = %v, want sql.ErrNoRows", err)
+	}
+	assertChirpIDs(t, "ListChirps(alice)", mustListChirps(t, s, alice.ID), third.ID)
+}
+
+func testTransactions(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+
+	var kept database.Chirp
+	err := s.InTx(ctx, func(tx Store) error {
+		kept = mustCreateChirp(t, tx, alice.ID, "kept")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("InTx() error = %v", err)
+	}
+
+	errRollback := errors.New("roll back")
+	var discarded database.Chirp
+	err = s.InTx(ctx, func(tx Store) error {
+		discarded = mustCreateChirp(t, tx, alice.ID, "discarded")
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Errorf("InTx() error = %v, want %v", err, errRollback)
+	}
+	if _, err := s.GetChirp(ctx, discarded.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetChirp() of a rolled back chirp error = %v, want sql.ErrNoRows", err)
+	}
+	assertChirpIDs(t, "ListChirps() after InTx()", mustListChirps(t, s), kept.ID)
+}
+
+func testChirpRevisions(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	chirp := mustCreateChirp(t, s, alice.ID, "helo")
+
+	if _, err := s.UpdateChirp(ctx, database.UpdateChirpParams{ID: uuid.New(), Body: "nope"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UpdateChirp() of unknown chirp error = %v, want sql.ErrNoRows", err)
+	}
+	edited, err := s.UpdateChirp(ctx, database.UpdateChirpParams{ID: chirp.ID, Body: "hello"})
+	if err != nil {
+		t.Fatalf("UpdateChirp() error = %v", err)
+	}
+	if edited.Body != "hello" || !edited.CreatedAt.Equal(chirp.CreatedAt) || !edited.UpdatedAt.After(chirp.UpdatedAt) {
+		t.Errorf("UpdateChirp() = %+v, want new body and later updated_at than %+v", edited, chirp)
+	}
+	again, err := s.UpdateChirp(ctx, database.UpdateChirpParams{ID: chirp.ID, Body: "hello, world"})
+	if err != nil {
+		t.Fatalf("UpdateChirp() error = %v", err)
+	}
+	if got, err := s.GetChirp(ctx, chirp.ID); err != nil || got.Body != "hello, world" {
+		t.Errorf("GetChirp() after UpdateChirp() = %+v, %v", got, err)
+	}
+
+	revisions, err := s.GetChirpRevisions(ctx, chirp.ID)
+	if err != nil {
+		t.Fatalf("GetChirpRevisions() error = %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("GetChirpRevisions() = %+v, want 2 revisions", revisions)
+	}
+	for i, want := range []database.Chirp{chirp, edited} {
+		got := revisions[i]
+		if got.ChirpID != chirp.ID || got.Body != want.Body || !got.CreatedAt.Equal(want.UpdatedAt) {
+			t.Errorf("revision %d = %+v, want body %q written at %v", i, got, want.Body, want.UpdatedAt)
+		}
+	}
+	if !revisions[1].ReplacedAt.Equal(again.UpdatedAt) {
+		t.Errorf("revision 1 replaced at %v, want %v", revisions[1].ReplacedAt, again.UpdatedAt)
+	}
+
+	if err := s.DeleteChirp(ctx, chirp.ID); err != nil {
+		t.Fatalf("DeleteChirp() error = %v", err)
+	}
+	if revisions, err := s.GetChirpRevisions(ctx, chirp.ID); err != nil || len(revisions) != 0 {
+		t.Errorf("GetChirpRevisions() after DeleteChirp() = %+v, %v", revisions, err)
+	}
+}
+
+func testChirpReplies(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+	reply := func(author database.User, parent database.Chirp, body string) database.Chirp {
+		t.Helper()
+		chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{
+			Body:     body,
+			UserID:   author.ID,
+			ParentID: uuid.NullUUID{UUID: parent.ID, Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("CreateChirp(%q) error = %v", body, err)
+		}
+		return chirp
+	}
+	get := func(chirp database.Chirp) database.Chirp {
+		t.Helper()
+		got, err := s.GetChirp(ctx, chirp.ID)
+		if err != nil {
+			t.Fatalf("GetChirp() error = %v", err)
+		}
+		return got
+	}
+	ancestors := func(chirp database.Chirp) []database.Chirp {
+		t.Helper()
+		chirps, err := s.GetChirpAncestors(ctx, chirp.ID)
+		if err != nil {
+			t.Fatalf("GetChirpAncestors() error = %v", err)
+		}
+		return chirps
+	}
+	descendants := func(arg database.GetChirpDescendantsParams) []database.GetChirpDescendantsRow {
+		t.Helper()
+		rows, err := s.GetChirpDescendants(ctx, arg)
+		if err != nil {
+			t.Fatalf("GetChirpDescendants(%+v) error = %v", arg, err)
+		}
+		return rows
+	}
+	assertRows := func(name string, rows []database.GetChirpDescendantsRow, want ...database.Chirp) {
+		t.Helper()
+		chirps := make([]database.Chirp, 0, len(rows))
+		for _, row := range rows {
+			chirps = append(chirps, row.Chirp)
+		}
+		ids := make([]uuid.UUID, 0, len(want))
+		for _, chirp := range want {
+			ids = append(ids, chirp.ID)
+		}
+		assertChirpIDs(t, name, chirps, ids...)
+	}
+
+	root := mustCreateChirp(t, s, alice.ID, "root")
+	a := reply(bob, root, "a")
+	b := reply(alice, root, "b")
+	a1 := reply(alice, a, "a1")
+	a1x := reply(bob, a1, "a1x")
+
+	if _, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "orphan", UserID: alice.ID, ParentID: uuid.NullUUID{UUID: uuid.New(), Valid: true}}); err == nil {
+		t.Error("CreateChirp() replying to an unknown chirp should fail")
+	}
+	if root.IsReply || root.ParentID.Valid {
+		t.Errorf("CreateChirp() without parent = %+v", root)
+	}
+	if !a.IsReply || a.ParentID.UUID != root.ID {
+		t.Errorf("CreateChirp() with parent = %+v", a)
+	}
+	if got := get(root); got.ReplyCount != 2 {
+		t.Errorf("root reply count = %d, want 2", got.ReplyCount)
+	}
+	if got := get(a); got.ReplyCount != 1 {
+		t.Errorf("reply count = %d, want 1", got.ReplyCount)
+	}
+
+	assertChirpIDs(t, "GetChirpAncestors()", ancestors(a1x), root.ID, a.ID, a1.ID)
+	assertChirpIDs(t, "GetChirpAncestors() of root", ancestors(root))
+
+	rows := descendants(database.GetChirpDescendantsParams{ID: root.ID, Limit: 10})
+	assertRows("GetChirpDescendants()", rows, a, a1, a1x, b)
+	for i, want := range []int32{1, 2, 3, 1} {
+		if rows[i].Depth != want || len(rows[i].Path) != int(want) {
+			t.Errorf("GetChirpDescendants()[%d] depth = %d, path = %q; want depth %d", i, rows[i].Depth, rows[i].Path, want)
+		}
+	}
+	page := descendants(database.GetChirpDescendantsParams{ID: root.ID, Limit: 2})
+	assertRows("GetChirpDescendants() first page", page, a, a1)
+	page = descendants(database.GetChirpDescendantsParams{ID: root.ID, AfterPath: page[1].Path, Limit: 2})
+	assertRows("GetChirpDescendants() second page", page, a1x, b)
+	assertRows("GetChirpDescendants() of reply", descendants(database.GetChirpDescendantsParams{ID: a.ID, Limit: 10}), a1, a1x)
+
+	if err := s.DeleteChirp(ctx, a.ID); err != nil {
+		t.Fatalf("DeleteChirp() error = %v", err)
+	}
+	if got := get(root); got.ReplyCount != 1 {
+		t.Errorf("root reply count after deleting a reply = %d, want 1", got.ReplyCount)
+	}
+	if got := get(a1); got.ParentID.Valid || !got.IsReply {
+		t.Errorf("reply to deleted chirp = %+v, want no parent but still a reply", got)
+	}
+	assertRows("GetChirpDescendants() after delete", descendants(database.GetChirpDescendantsParams{ID: root.ID, Limit: 10}), b)
+	assertChirpIDs(t, "GetChirpAncestors() after delete", ancestors(a1x), a1.ID)
+}
+
+func testChirpLikes(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+	first := mustCreateChirp(t, s, alice.ID, "first")
+	second := mustCreateChirp(t, s, bob.ID, "second")
+
+	like := func(chirp database.Chirp, user database.User) {
+		t.Helper()
+		if err := s.LikeChirp(ctx, database.LikeChirpParams{ChirpID: chirp.ID, UserID: user.ID}); err != nil {
+			t.Fatalf("LikeChirp() error = %v", err)
+		}
+	}
+	unlike := func(chirp database.Chirp, user database.User) {
+		t.Helper()
+		if err := s.UnlikeChirp(ctx, database.UnlikeChirpParams{ChirpID: chirp.ID, UserID: user.ID}); err != nil {
+			t.Fatalf("UnlikeChirp() error = %v", err)
+		}
+	}
+	assertLikes := func(chirp database.Chirp, want int32) {
+		t.Helper()
+		got, err := s.GetChirp(ctx, chirp.ID)
+		if err != nil || got.LikeCount != want {
+			t.Errorf("GetChirp(%q) like count = %d, %v; want %d", chirp.Body, got.LikeCount, err, want)
+		}
+	}
+	liked := func(arg database.ListLikedChirpsParams) []database.Chirp {
+		t.Helper()
+		rows, err := s.ListLikedChirps(ctx, arg)
+		if err != nil {
+			t.Fatalf("ListLikedChirps() error = %v", err)
+		}
+		chirps := make([]database.Chirp, 0, len(rows))
+		for _, row := range rows {
+			chirps = append(chirps, database.Chirp{ID: row.Chirp.ID, CreatedAt: row.LikedAt})
+		}
+		return chirps
+	}
+
+	like(first, bob)
+	like(first, bob)
+	assertLikes(first, 1)
+	like(first, alice)
+	like(second, bob)
+	assertLikes(first, 2)
+	assertLikes(second, 1)
+	if err := s.LikeChirp(ctx, database.LikeChirpParams{ChirpID: uuid.New(), UserID: bob.ID}); err == nil {
+		t.Error("LikeChirp() of unknown chirp should fail")
+	}
+
+	ids, err := s.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{
+		UserID:   bob.ID,
+		ChirpIds: []uuid.UUID{first.ID, second.ID, uuid.New()},
+	})
+	slices.SortFunc(ids, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+	want := []uuid.UUID{first.ID, second.ID}
+	slices.SortFunc(want, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+	if err != nil || !slices.Equal(ids, want) {
+		t.Errorf("GetLikedChirpIDs() = %v, %v; want %v", ids, err, want)
+	}
+
+	assertChirpIDs(t, "ListLikedChirps()", liked(database.ListLikedChirpsParams{UserID: bob.ID, Limit: 10}), second.ID, first.ID)
+	page := liked(database.ListLikedChirpsParams{UserID: bob.ID, Limit: 1})
+	assertChirpIDs(t, "ListLikedChirps() first page", page, second.ID)
+	page = liked(database.ListLikedChirpsParams{
+		UserID:        bob.ID,
+		BeforeLikedAt: sql.NullTime{Time: page[0].CreatedAt, Valid: true},
+		BeforeID:      uuid.NullUUID{UUID: page[0].ID, Valid: true},
+		Limit:         1,
+	})
+	assertChirpIDs(t, "ListLikedChirps() second page", page, first.ID)
+
+	unlike(first, bob)
+	unlike(first, bob)
+	assertLikes(first, 1)
+	unlike(second, alice)
+	assertLikes(second, 1)
+
+	if err := s.DeleteChirp(ctx, second.ID); err != nil {
+		t.Fatalf("DeleteChirp() error = %v", err)
+	}
+	assertChirpIDs(t, "ListLikedChirps() after delete", liked(database.ListLikedChirpsParams{UserID: bob.ID, Limit: 10}))
+}
+
+func testRechirps(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+	original := mustCreateChirp(t, s, alice.ID, "original")
+	ref := uuid.NullUUID{UUID: original.ID, Valid: true}
+
+	rechirp, err := s.CreateChirp(ctx, database.CreateChirpParams{UserID: bob.ID, RechirpOf: ref})
+	if err != nil || rechirp.RechirpOf != ref || rechirp.IsQuote {
+		t.Fatalf("CreateChirp() rechirp = %+v, %v", rechirp, err)
+	}
+	quote, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "quote", UserID: bob.ID, QuoteOf: ref})
+	if err != nil || quote.QuoteOf != ref || !quote.IsQuote {
+		t.Fatalf("CreateChirp() quote = %+v, %v", quote, err)
+	}
+	quotingReply, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "quoting reply", UserID: bob.ID, ParentID: ref, QuoteOf: ref})
+	if err != nil {
+		t.Fatalf("CreateChirp() quoting reply error = %v", err)
+	}
+	if _, err := s.CreateChirp(ctx, database.CreateChirpParams{UserID: bob.ID, RechirpOf: ref}); !IsUniqueViolation(err, ChirpsRechirpKey) {
+		t.Errorf("CreateChirp() rechirping the same chirp twice error = %v, want a violation of %s", err, ChirpsRechirpKey)
+	}
+	if _, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "with body", UserID: alice.ID, RechirpOf: ref}); err == nil {
+		t.Error("CreateChirp() rechirp with a body should fail")
+	}
+	if _, err := s.CreateChirp(ctx, database.CreateChirpParams{UserID: alice.ID, RechirpOf: uuid.NullUUID{UUID: uuid.New(), Valid: true}}); err == nil {
+		t.Error("CreateChirp() rechirp of an unknown chirp should fail")
+	}
+
+	got, err := s.GetChirp(ctx, original.ID)
+	if err != nil || got.RechirpCount != 1 || got.QuoteCount != 2 {
+		t.Errorf("GetChirp() counts = %d rechirps, %d quotes, %v; want 1, 2", got.RechirpCount, got.QuoteCount, err)
+	}
+	got, err = s.GetRechirp(ctx, database.GetRechirpParams{UserID: bob.ID, RechirpOf: ref})
+	if err != nil || got.ID != rechirp.ID {
+		t.Errorf("GetRechirp() = %+v, %v; want %s", got, err, rechirp.ID)
+	}
+	if _, err := s.GetRechirp(ctx, database.GetRechirpParams{UserID: alice.ID, RechirpOf: ref}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetRechirp() of a user who did not rechirp error = %v, want sql.ErrNoRows", err)
+	}
+	chirps, err := s.GetChirpsByIDs(ctx, []uuid.UUID{original.ID, quote.ID, uuid.New()})
+	slices.SortFunc(chirps, func(a, b database.Chirp) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	if err != nil {
+		t.Fatalf("GetChirpsByIDs() error = %v", err)
+	}
+	assertChirpIDs(t, "GetChirpsByIDs()", chirps, original.ID, quote.ID)
+
+	if err := s.DeleteChirp(ctx, original.ID); err != nil {
+		t.Fatalf("DeleteChirp() error = %v", err)
+	}
+	if _, err := s.GetChirp(ctx, rechirp.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetChirp() of rechirp after deleting the original error = %v, want sql.ErrNoRows", err)
+	}
+	got, err = s.GetChirp(ctx, quote.ID)
+	if err != nil || got.QuoteOf.Valid || !got.IsQuote {
+		t.Errorf("GetChirp() of quote after deleting the original = %+v, %v; want no quote_of but still a quote", got, err)
+	}
+	got, err = s.GetChirp(ctx, quotingReply.ID)
+	if err != nil || got.ParentID.Valid || got.QuoteOf.Valid || !got.IsReply || !got.IsQuote {
+		t.Errorf("GetChirp() of quoting reply after deleting the original = %+v, %v; want neither parent_id nor quote_of", got, err)
+	}
+}
+
+func testChirpTags(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	first := mustCreateChirp(t, s, alice.ID, "#go #sql")
+	second := mustCreateChirp(t, s, alice.ID, "#go")
+	third := mustCreateChirp(t, s, alice.ID, "untagged")
+
+	setTags := func(chirp database.Chirp, names ...string) {
+		t.Helper()
+		if err := s.SetChirpTags(ctx, database.SetChirpTagsParams{ChirpID: chirp.ID, Names: names}); err != nil {
+			t.Fatalf("SetChirpTags(%q) error = %v", names, err)
+		}
+	}
+	assertTags := func(name string, want ...database.GetChirpTagsRow) {
+		t.Helper()
+		rows, err := s.GetChirpTags(ctx, []uuid.UUID{first.ID, second.ID, third.ID})
+		if err != nil {
+			t.Fatalf("GetChirpTags() error = %v", err)
+		}
+		slices.SortStableFunc(rows, func(a, b database.GetChirpTagsRow) int {
+			return compareChirps(database.Chirp{ID: a.ChirpID}, database.Chirp{ID: b.ChirpID})
+		})
+		slices.SortStableFunc(want, func(a, b database.GetChirpTagsRow) int {
+			return compareChirps(database.Chirp{ID: a.ChirpID}, database.Chirp{ID: b.ChirpID})
+		})
+		if !slices.Equal(rows, want) {
+			t.Errorf("%s = %+v, want %+v", name, rows, want)
+		}
+	}
+	tagged := func(arg database.ListTagChirpsParams) []database.Chirp {
+		t.Helper()
+		chirps, err := s.ListTagChirps(ctx, arg)
+		if err != nil {
+			t.Fatalf("ListTagChirps(%+v) error = %v", arg, err)
+		}
+		return chirps
+	}
+	trending := func(since time.Time) []database.TrendingTagsRow {
+		t.Helper()
+		rows, err := s.TrendingTags(ctx, database.TrendingTagsParams{Since: since, Limit: 10})
+		if err != nil {
+			t.Fatalf("TrendingTags() error = %v", err)
+		}
+		return rows
+	}
+
+	setTags(first, "go", "sql")
+	setTags(second, "go")
+	setTags(second, "go")
+	assertTags("GetChirpTags()",
+		database.GetChirpTagsRow{ChirpID: first.ID, Name: "go"},
+		database.GetChirpTagsRow{ChirpID: first.ID, Name: "sql"},
+		database.GetChirpTagsRow{ChirpID: second.ID, Name: "go"},
+	)
+
+	assertChirpIDs(t, "ListTagChirps()", tagged(database.ListTagChirpsParams{Tag: "go", Limit: 10}), second.ID, first.ID)
+	assertChirpIDs(t, "ListTagChirps() of unknown tag", tagged(database.ListTagChirpsParams{Tag: "rust", Limit: 10}))
+	page := tagged(database.ListTagChirpsParams{Tag: "go", Limit: 1})
+	assertChirpIDs(t, "ListTagChirps() first page", page, second.ID)
+	page = tagged(database.ListTagChirpsParams{
+		Tag:             "go",
+		BeforeCreatedAt: sql.NullTime{Time: page[0].CreatedAt, Valid: true},
+		BeforeID:        uuid.NullUUID{UUID: page[0].ID, Valid: true},
+		Limit:           1,
+	})
+	assertChirpIDs(t, "ListTagChirps() second page", page, first.ID)
+
+	want := []database.TrendingTagsRow{{Name: "go", ChirpCount: 2}, {Name: "sql", ChirpCount: 1}}
+	if got := trending(first.CreatedAt); !slices.Equal(got, want) {
+		t.Errorf("TrendingTags() = %+v, want %+v", got, want)
+	}
+	want = []database.TrendingTagsRow{{Name: "go", ChirpCount: 1}}
+	if got := trending(second.CreatedAt); !slices.Equal(got, want) {
+		t.Errorf("TrendingTags() since the second chirp = %+v, want %+v", got, want)
+	}
+
+	setTags(first, "sql", "chirpy")
+	setTags(second)
+	assertTags("GetChirpTags() after replacing",
+		database.GetChirpTagsRow{ChirpID: first.ID, Name: "chirpy"},
+		database.GetChirpTagsRow{ChirpID: first.ID, Name: "sql"},
+	)
+
+	if err := s.DeleteChirp(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteChirp() error = %v", err)
+	}
+	assertChirpIDs(t, "ListTagChirps() after delete", tagged(database.ListTagChirpsParams{Tag: "sql", Limit: 10}))
+	if got := trending(time.Time{}); len(got) != 0 {
+		t.Errorf("TrendingTags() after delete = %+v, want none", got)
+	}
+}
+
+func testChirpMentions(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+	for user, handle := range map[uuid.UUID]string{alice.ID: "Alice", bob.ID: "bob"} {
+		if _, err := s.UpdateUser(ctx, database.UpdateUserParams{
+			ID:     user,
+			Email:  handle + "@example.com",
+			Handle: sql.NullString{String: handle, Valid: true},
+		}); err != nil {
+			t.Fatalf("UpdateUser() error = %v", err)
+		}
+	}
+	first := mustCreateChirp(t, s, alice.ID, "@bob @nobody")
+	second := mustCreateChirp(t, s, bob.ID, "@alice @bob")
+
+	setMentions := func(chirp database.Chirp, handles ...string) {
+		t.Helper()
+		if err := s.SetChirpMentions(ctx, database.SetChirpMentionsParams{ChirpID: chirp.ID, Handles: handles}); err != nil {
+			t.Fatalf("SetChirpMentions(%q) error = %v", handles, err)
+		}
+	}
+	mentions := func(chirp database.Chirp) []database.GetChirpMentionsRow {
+		t.Helper()
+		rows, err := s.GetChirpMentions(ctx, []uuid.UUID{chirp.ID})
+		if err != nil {
+			t.Fatalf("GetChirpMentions() error = %v", err)
+		}
+		slices.SortFunc(rows, func(a, b database.GetChirpMentionsRow) int { return strings.Compare(a.Handle, b.Handle) })
+		return rows
+	}
+	mentioning := func(arg database.ListMentionsParams) []database.Chirp {
+		t.Helper()
+		chirps, err := s.ListMentions(ctx, arg)
+		if err != nil {
+			t.Fatalf("ListMentions(%+v) error = %v", arg, err)
+		}
+		return chirps
+	}
+
+	setMentions(first, "bob", "nobody")
+	setMentions(second, "alice", "bob")
+	want := []database.GetChirpMentionsRow{{ChirpID: first.ID, UserID: bob.ID, Handle: "bob"}}
+	if got := mentions(first); !slices.Equal(got, want) {
+		t.Errorf("GetChirpMentions() = %+v, want %+v", got, want)
+	}
+	want = []database.GetChirpMentionsRow{
+		{ChirpID: second.ID, UserID: alice.ID, Handle: "Alice"},
+		{ChirpID: second.ID, UserID: bob.ID, Handle: "bob"},
+	}
+	if got := mentions(second); !slices.Equal(got, want) {
+		t.Errorf("GetChirpMentions() = %+v, want %+v", got, want)
+	}
+
+	assertChirpIDs(t, "ListMentions()", mentioning(database.ListMentionsParams{UserID: bob.ID, Limit: 10}), second.ID, first.ID)
+	page := mentioning(database.ListMentionsParams{UserID: bob.ID, Limit: 1})
+	assertChirpIDs(t, "ListMentions() first page", page, second.ID)
+	page = mentioning(database.ListMentionsParams{
+		UserID:          bob.ID,
+		BeforeCreatedAt: sql.NullTime{Time: page[0].CreatedAt, Valid: true},
+		BeforeID:        uuid.NullUUID{UUID: page[0].ID, Valid: true},
+		Limit:           1,
+	})
+	assertChirpIDs(t, "ListMentions() second page", page, first.ID)
+
+	setMentions(second, "alice")
+	assertChirpIDs(t, "ListMentions() after replacing", mentioning(database.ListMentionsParams{UserID: bob.ID, Limit: 10}), first.ID)
+	if err := s.DeleteChirp(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteChirp() error = %v", err)
+	}
+	assertChirpIDs(t, "ListMentions() after delete", mentioning(database.ListMentionsParams{UserID: bob.ID, Limit: 10}))
+}
+
+func testRefreshTokens(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "saul@example.com")
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     "token",
+		UserID:    user.ID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+	if err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "other", UserID: uuid.New(), ExpiresAt: expiresAt}); err == nil {
+		t.Error("CreateRefreshToken() for unknown user should fail")
+	}
+
+	token, err := s.GetRefreshToken(ctx, "token")
+	if err != nil {
+		t.Fatalf("GetRefreshToken() error = %v", err)
+	}
+	if token.UserID != user.ID || !token.ExpiresAt.Equal(expiresAt) || token.RevokedAt.Valid {
+		t.Errorf("GetRefreshToken() = %+v", token)
+	}
+	if _, err := s.GetRefreshToken(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetRefreshToken() of unknown token error = %v, want sql.ErrNoRows", err)
+	}
+
+	userID, err := s.GetUserFromRefreshToken(ctx, "token")
+	if err != nil || userID != user.ID {
+		t.Errorf("GetUserFromRefreshToken() = %s, %v; want %s", userID, err, user.ID)
+	}
+
+	err = s.RevokeRefreshToken(ctx, database.RevokeRefreshTokenParams{Token: "token", UpdatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("RevokeRefreshToken() error = %v", err)
+	}
+	token, err = s.GetRefreshToken(ctx, "token")
+	if err != nil || !token.RevokedAt.Valid {
+		t.Errorf("GetRefreshToken() after revoke = %+v, %v", token, err)
+	}
+}
+
+func testFollows(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+	carol := mustCreateUser(t, s, "carol@example.com")
+
+	follow := func(follower, followee uuid.UUID) error {
+		return s.FollowUser(ctx, database.FollowUserParams{FollowerID: follower, FolloweeID: followee})
+	}
+	wantFollowers := func(user database.User, want int64) {
+		t.Helper()
+		if got, err := s.CountFollowers(ctx, user.ID); err != nil || got != want {
+			t.Errorf("CountFollowers(%s) = %d, %v; want %d", user.Email, got, err, want)
+		}
+	}
+
+	for _, follower := range []uuid.UUID{bob.ID, bob.ID, carol.ID} {
+		if err := follow(follower, alice.ID); err != nil {
+			t.Fatalf("FollowUser() error = %v", err)
+		}
+	}
+	if err := follow(alice.ID, alice.ID); err == nil {
+		t.Error("FollowUser() of oneself should fail")
+	}
+	if err := follow(alice.ID, uuid.New()); err == nil {
+		t.Error("FollowUser() of unknown user should fail")
+	}
+	wantFollowers(alice, 2)
+	wantFollowers(bob, 0)
+
+	for range 2 {
+		if err := s.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: bob.ID, FolloweeID: alice.ID}); err != nil {
+			t.Fatalf("UnfollowUser() error = %v", err)
+		}
+	}
+	wantFollowers(alice, 1)
+}
+
+func testDeleteUsersCascades(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "mike@example.com")
+	chirp := mustCreateChirp(t, s, user.ID, "hello")
+	err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     "token",
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+
+	if err := s.DeleteUsers(ctx); err != nil {
+		t.Fatalf("DeleteUsers() error = %v", err)
+	}
+	if _, err := s.GetUser(ctx, user.Email); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUser() after DeleteUsers error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.GetChirp(ctx, chirp.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetChirp() after DeleteUsers error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.GetRefreshToken(ctx, "token"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetRefreshToken() after DeleteUsers error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testLoginThrottles(t *testing.T, s Store) {
+	ctx := context.Background()
+	start := time.Now().UTC().Truncate(time.Second)
+	record := func(key string, now time.Time) database.LoginThrottle {
+		t.Helper()
+		throttle, err := s.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Key:         key,
+			Now:         now,
+			WindowStart: now.Add(-time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("RecordLoginFailure() error = %v", err)
+		}
+		return throttle
+	}
+
+	if _, err := s.GetLoginThrottle(ctx, "account:a"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetLoginThrottle() of unknown key error = %v, want sql.ErrNoRows", err)
+	}
+	if got := record("account:a", start).Failures; got != 1 {
+		t.Errorf("first failure count = %d, want 1", got)
+	}
+	if got := record("account:a", start.Add(time.Minute)).Failures; got != 2 {
+		t.Errorf("second failure count = %d, want 2", got)
+	}
+	if got := record("account:a", start.Add(3*time.Hour)).Failures; got != 1 {
+		t.Errorf("failure count after the window = %d, want 1", got)
+	}
+
+	lockedUntil := start.Add(4 * time.Hour)
+	err := s.LockLoginThrottle(ctx, database.LockLoginThrottleParams{
+		Key:         "account:a",
+		LockedUntil: sql.NullTime{Time: lockedUntil, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("LockLoginThrottle() error = %v", err)
+	}
+	throttle, err := s.GetLoginThrottle(ctx, "account:a")
+	if err != nil || !throttle.LockedUntil.Valid || !throttle.LockedUntil.Time.Equal(lockedUntil) {
+		t.Errorf("GetLoginThrottle() = %+v, %v; want locked until %s", throttle, err, lockedUntil)
+	}
+
+	record("ip:192.0.2.1", start)
+	if err := s.DeleteIdleLoginThrottles(ctx, start.Add(3*time.Hour+time.Minute)); err != nil {
+		t.Fatalf("DeleteIdleLoginThrottles() error = %v", err)
+	}
+	if _, err := s.GetLoginThrottle(ctx, "ip:192.0.2.1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("idle throttle not deleted, error = %v", err)
+	}
+	if _, err := s.GetLoginThrottle(ctx, "account:a"); err != nil {
+		t.Errorf("locked throttle deleted, error = %v", err)
+	}
+
+	if err := s.DeleteLoginThrottle(ctx, "account:a"); err != nil {
+		t.Fatalf("DeleteLoginThrottle() error = %v", err)
+	}
+	if _, err := s.GetLoginThrottle(ctx, "account:a"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetLoginThrottle() after delete error = %v, want sql.ErrNoRows", err)
+	}
+
+	user := mustCreateUser(t, s, "tuco@example.com")
+	for _, userID := range []uuid.NullUUID{{}, {UUID: user.ID, Valid: true}} {
+		err := s.CreateLoginEvent(ctx, database.CreateLoginEventParams{
+			Email:  user.Email,
+			UserID: userID,
+			Ip:     "192.0.2.1",
+			Event:  "failure",
+		})
+		if err != nil {
+			t.Errorf("CreateLoginEvent() error = %v", err)
+		}
+	}
+}
+
+func mustListChirps(t *testing.T, s Store, authorIDs ...uuid.UUID) []database.Chirp {
+	t.Helper()
+	chirps, err := s.ListChirps(context.Background(), database.ListChirpsParams{AuthorIds: authorIDs, Limit: 100})
+	if err != nil {
+		t.Fatalf("ListChirps() error = %v", err)
+	}
+	return chirps
+}
+
+func assertChirpIDs(t *testing.T, name string, chirps []database.Chirp, want ...uuid.UUID) {
+	t.Helper()
+	if len(chirps) != len(want) {
+		t.Errorf("%s returned %d chirps, want %d", name, len(chirps), len(want))
+		return
+	}
+	for i, chirp := range chirps {
+		if chirp.ID != want[i] {
+			t.Errorf("%s[%d] = %s, want %s", name, i, chirp.ID, want[i])
+		}
+	}
+}
+
+func testAdmin(t *testing.T, s Store) {
+	ctx := context.Background()
+	walt := mustCreateUser(t, s, "walt@example.com")
+	jesse := mustCreateUser(t, s, "jesse@example.com")
+	skyler := mustCreateUser(t, s, "skyler@example.net")
+	if walt.IsAdmin {
+		t.Errorf("CreateUser() = %+v, want a non-admin", walt)
+	}
+
+	admin, err := s.SetUserAdmin(ctx, database.SetUserAdminParams{Email: walt.Email, IsAdmin: true})
+	if err != nil || !admin.IsAdmin || admin.ID != walt.ID {
+		t.Errorf("SetUserAdmin() = %+v, %v", admin, err)
+	}
+	if got, err := s.GetUserByID(ctx, walt.ID); err != nil || !got.IsAdmin {
+		t.Errorf("GetUserByID() after SetUserAdmin() = %+v, %v", got, err)
+	}
+	if _, err := s.SetUserAdmin(ctx, database.SetUserAdminParams{Email: "nobody@example.com", IsAdmin: true}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SetUserAdmin() of unknown email error = %v, want sql.ErrNoRows", err)
+	}
+
+	red, err := s.SetChirpyRed(ctx, database.SetChirpyRedParams{ID: jesse.ID, IsChirpyRed: true})
+	if err != nil || !red.IsChirpyRed {
+		t.Errorf("SetChirpyRed(true) = %+v, %v", red, err)
+	}
+	red, err = s.SetChirpyRed(ctx, database.SetChirpyRedParams{ID: jesse.ID, IsChirpyRed: false})
+	if err != nil || red.IsChirpyRed {
+		t.Errorf("SetChirpyRed(false) = %+v, %v", red, err)
+	}
+	if _, err := s.SetChirpyRed(ctx, database.SetChirpyRedParams{ID: uuid.New()}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SetChirpyRed() of unknown user error = %v, want sql.ErrNoRows", err)
+	}
+
+	userIDs := func(users []database.User) []uuid.UUID {
+		var ids []uuid.UUID
+		for _, u := range users {
+			ids = append(ids, u.ID)
+		}
+		return ids
+	}
+	for _, tt := range []struct {
+		arg  database.ListUsersParams
+		want []uuid.UUID
+	}{
+		{database.ListUsersParams{Limit: 10}, []uuid.UUID{walt.ID, jesse.ID, skyler.ID}},
+		{database.ListUsersParams{Query: "EXAMPLE.COM", Limit: 10}, []uuid.UUID{walt.ID, jesse.ID}},
+		{database.ListUsersParams{Query: "_", Limit: 10}, nil},
+		{database.ListUsersParams{Query: "%", Limit: 10}, nil},
+		{database.ListUsersParams{Limit: 1, Offset: 1}, []uuid.UUID{jesse.ID}},
+		{database.ListUsersParams{Limit: 10, Offset: 5}, nil},
+	} {
+		users, err := s.ListUsers(ctx, tt.arg)
+		if err != nil {
+			t.Fatalf("ListUsers(%+v) error = %v", tt.arg, err)
+		}
+		if got := userIDs(users); !slices.Equal(got, tt.want) {
+			t.Errorf("ListUsers(%+v) = %v, want %v", tt.arg, got, tt.want)
+		}
+	}
+
+	for _, token := range []string{"older", "newer"} {
+		err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: token, UserID: jesse.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatalf("CreateRefreshToken() error = %v", err)
+		}
+	}
+	tokens, err := s.GetRefreshTokensForUser(ctx, jesse.ID)
+	if err != nil || len(tokens) != 2 || tokens[0].Token != "newer" {
+		t.Errorf("GetRefreshTokensForUser() = %+v, %v; want newest of 2 first", tokens, err)
+	}
+	if tokens, err := s.GetRefreshTokensForUser(ctx, walt.ID); err != nil || len(tokens) != 0 {
+		t.Errorf("GetRefreshTokensForUser() of user without tokens = %+v, %v", tokens, err)
+	}
+}
+
+func testListChirps(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+	var all, alices []uuid.UUID
+	for i := range 5 {
+		author := alice
+		if i%2 == 1 {
+			author = bob
+		}
+		chirp := mustCreateChirp(t, s, author.ID, fmt.Sprintf("chirp %d", i))
+		all = append(all, chirp.ID)
+		if author.ID == alice.ID {
+			alices = append(alices, chirp.ID)
+		}
+	}
+
+	list := func(arg database.ListChirpsParams) []database.Chirp {
+		t.Helper()
+		chirps, err := s.ListChirps(ctx, arg)
+		if err != nil {
+			t.Fatalf("ListChirps(%+v) error = %v", arg, err)
+		}
+		return chirps
+	}
+	after := func(c database.Chirp) (sql.NullTime, uuid.NullUUID) {
+		return sql.NullTime{Time: c.CreatedAt, Valid: true}, uuid.NullUUID{UUID: c.ID, Valid: true}
+	}
+
+	assertChirpIDs(t, "ListChirps()", list(database.ListChirpsParams{Limit: 10}), all...)
+	page := list(database.ListChirpsParams{Limit: 2})
+	assertChirpIDs(t, "ListChirps() first page", page, all[:2]...)
+	afterCreatedAt, afterID := after(page[1])
+	page = list(database.ListChirpsParams{AfterCreatedAt: afterCreatedAt, AfterID: afterID, Limit: 2})
+	assertChirpIDs(t, "ListChirps() second page", page, all[2:4]...)
+	afterCreatedAt, afterID = after(page[1])
+	page = list(database.ListChirpsParams{AfterCreatedAt: afterCreatedAt, AfterID: afterID, Limit: 2})
+	assertChirpIDs(t, "ListChirps() last page", page, all[4:]...)
+
+	byAlice := []uuid.UUID{alice.ID}
+	page = list(database.ListChirpsParams{AuthorIds: byAlice, Limit: 2})
+	assertChirpIDs(t, "ListChirps() by author", page, alices[:2]...)
+	afterCreatedAt, afterID = after(page[1])
+	page = list(database.ListChirpsParams{AuthorIds: byAlice, AfterCreatedAt: afterCreatedAt, AfterID: afterID, Limit: 2})
+	assertChirpIDs(t, "ListChirps() by author second page", page, alices[2:]...)
+	page = list(database.ListChirpsParams{AuthorIds: []uuid.UUID{alice.ID, bob.ID}, Limit: 10})
+	assertChirpIDs(t, "ListChirps() by both authors", page, all...)
+	page = list(database.ListChirpsParams{AuthorIds: []uuid.UUID{uuid.New()}, Limit: 10})
+	assertChirpIDs(t, "ListChirps() by unknown author", page)
+
+	chirps := list(database.ListChirpsParams{Limit: 10})
+	since := sql.NullTime{Time: chirps[1].CreatedAt, Valid: true}
+	until := sql.NullTime{Time: chirps[3].CreatedAt, Valid: true}
+	page = list(database.ListChirpsParams{Since: since, Until: until, Limit: 10})
+	assertChirpIDs(t, "ListChirps() since and until", page, all[1:3]...)
+
+	listDesc := func(arg database.ListChirpsDescParams) []database.Chirp {
+		t.Helper()
+		chirps, err := s.ListChirpsDesc(ctx, arg)
+		if err != nil {
+			t.Fatalf("ListChirpsDesc(%+v) error = %v", arg, err)
+		}
+		return chirps
+	}
+	reversed := slices.Clone(all)
+	slices.Reverse(reversed)
+	page = listDesc(database.ListChirpsDescParams{Limit: 3})
+	assertChirpIDs(t, "ListChirpsDesc() first page", page, reversed[:3]...)
+	beforeCreatedAt, beforeID := after(page[2])
+	page = listDesc(database.ListChirpsDescParams{BeforeCreatedAt: beforeCreatedAt, BeforeID: beforeID, Limit: 3})
+	assertChirpIDs(t, "ListChirpsDesc() second page", page, reversed[3:]...)
+	afterCreatedAt, afterID = after(chirps[1])
+	page = listDesc(database.ListChirpsDescParams{AfterCreatedAt: afterCreatedAt, AfterID: afterID, Limit: 10})
+	assertChirpIDs(t, "ListChirpsDesc() newer than a chirp", page, reversed[:3]...)
+	page = listDesc(database.ListChirpsDescParams{AuthorIds: byAlice, Until: until, Limit: 10})
+	assertChirpIDs(t, "ListChirpsDesc() by author until", page, alices[1], alices[0])
+}
+
+func testSearchChirps(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+	var ids []uuid.UUID
+	for i, body := range []string{
+		"pebble lantern",
+		"pebble pebble",
+		"the lantern pebble gopher",
+		"nothing to see here",
+	} {
+		author := alice
+		if i%2 == 1 {
+			author = bob
+		}
+		ids = append(ids, mustCreateChirp(t, s, author.ID, body).ID)
+	}
+
+	recent := func(arg database.SearchChirpsRecentParams) []database.Chirp {
+		t.Helper()
+		chirps, err := s.SearchChirpsRecent(ctx, arg)
+		if err != nil {
+			t.Fatalf("SearchChirpsRecent(%+v) error = %v", arg, err)
+		}
+		return chirps
+	}
+	chirps := recent(database.SearchChirpsRecentParams{Query: "pebble", Limit: 10})
+	assertChirpIDs(t, "SearchChirpsRecent()", chirps, ids[2], ids[1], ids[0])
+	chirps = recent(database.SearchChirpsRecentParams{Query: "pebble", Limit: 2})
+	assertChirpIDs(t, "SearchChirpsRecent() first page", chirps, ids[2], ids[1])
+	chirps = recent(database.SearchChirpsRecentParams{
+		Query:           "pebble",
+		BeforeCreatedAt: sql.NullTime{Time: chirps[1].CreatedAt, Valid: true},
+		BeforeID:        uuid.NullUUID{UUID: chirps[1].ID, Valid: true},
+		Limit:           2,
+	})
+	assertChirpIDs(t, "SearchChirpsRecent() second page", chirps, ids[0])
+	chirps = recent(database.SearchChirpsRecentParams{Query: "pebble", AuthorIds: []uuid.UUID{alice.ID}, Limit: 10})
+	assertChirpIDs(t, "SearchChirpsRecent() by author", chirps, ids[2], ids[0])
+	chirps = recent(database.SearchChirpsRecentParams{Query: "goph:*", Limit: 10})
+	assertChirpIDs(t, "SearchChirpsRecent() by prefix", chirps, ids[2])
+	chirps = recent(database.SearchChirpsRecentParams{Query: "(lantern <-> pebble)", Limit: 10})
+	assertChirpIDs(t, "SearchChirpsRecent() by phrase", chirps, ids[2])
+	chirps = recent(database.SearchChirpsRecentParams{Query: "pebble & gopher", Limit: 10})
+	assertChirpIDs(t, "SearchChirpsRecent() by all words", chirps, ids[2])
+
+	// Rankings differ between stores, so only check that the chirp with the
+	// most matches comes first and that paging one row at a time yields the
+	// same order as a single page.
+	relevant := func(arg database.SearchChirpsParams) []database.SearchChirpsRow {
+		t.Helper()
+		rows, err := s.SearchChirps(ctx, arg)
+		if err != nil {
+			t.Fatalf("SearchChirps(%+v) error = %v", arg, err)
+		}
+		return rows
+	}
+	all := relevant(database.SearchChirpsParams{Query: "pebble", Limit: 10})
+	if len(all) != 3 || all[0].Chirp.ID != ids[1] {
+		t.Fatalf("SearchChirps() = %+v, want 3 rows starting with %s", all, ids[1])
+	}
+	arg := database.SearchChirpsParams{Query: "pebble", Limit: 1}
+	for i, want := range all {
+		rows := relevant(arg)
+		if len(rows) != 1 || rows[0].Chirp.ID != want.Chirp.ID {
+			t.Fatalf("SearchChirps() page %d = %+v, want %s", i, rows, want.Chirp.ID)
+		}
+		arg.BeforeRank = sql.NullFloat64{Float64: float64(rows[0].Rank), Valid: true}
+		arg.BeforeCreatedAt = sql.NullTime{Time: rows[0].Chirp.CreatedAt, Valid: true}
+		arg.BeforeID = uuid.NullUUID{UUID: rows[0].Chirp.ID, Valid: true}
+	}
+	if rows := relevant(arg); len(rows) != 0 {
+		t.Errorf("SearchChirps() after the last row = %+v", rows)
+	}
+	rows := relevant(database.SearchChirpsParams{Query: "pebble", AuthorIds: []uuid.UUID{bob.ID}, Limit: 10})
+	if len(rows) != 1 || rows[0].Chirp.ID != ids[1] {
+		t.Errorf("SearchChirps() by author = %+v, want %s", rows, ids[1])
+	}
+}
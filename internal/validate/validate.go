@@ -0,0 +1,83 @@
+// Package validate checks decoded request parameters and collects every
+// problem found, so that clients can fix all of them at once.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes why the value of a single field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors lists the invalid fields of a request.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid fields: " + strings.Join(msgs, "; ")
+}
+
+// Validator accumulates field errors. Only the first error of each field is
+// kept, and rules other than Required skip fields that are missing, so
+// optional fields can be checked without nil checks at the call site.
+type Validator struct {
+	errs Errors
+}
+
+// Check records message for field unless ok is true.
+func (v *Validator) Check(ok bool, field, message string) {
+	if ok || v.has(field) {
+		return
+	}
+	v.errs = append(v.errs, FieldError{Field: field, Message: message})
+}
+
+// Required rejects missing and empty values.
+func (v *Validator) Required(field string, value *string) {
+	v.Check(value != nil && strings.TrimSpace(*value) != "", field, "is required")
+}
+
+// Length rejects values shorter than min or longer than max characters.
+func (v *Validator) Length(field string, value *string, min, max int) {
+	if value == nil {
+		return
+	}
+	n := utf8.RuneCountInString(*value)
+	v.Check(n >= min, field, fmt.Sprintf("must be at least %d characters long", min))
+	v.Check(n <= max, field, fmt.Sprintf("must be at most %d characters long", max))
+}
+
+// Email rejects values that are not a bare email address.
+func (v *Validator) Email(field string, value *string) {
+	if value == nil {
+		return
+	}
+	addr, err := mail.ParseAddress(*value)
+	v.Check(err == nil && addr.Address == *value, field, "must be a valid email address")
+}
+
+// Err returns the collected errors as Errors, or nil if there are none.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+func (v *Validator) has(field string) bool {
+	for _, fe := range v.errs {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
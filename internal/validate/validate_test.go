@@ -0,0 +1,88 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestValidator(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(v *Validator)
+		want  Errors
+	}{
+		{
+			name: "Valid",
+			check: func(v *Validator) {
+				v.Required("email", ptr("walt@example.com"))
+				v.Email("email", ptr("walt@example.com"))
+				v.Length("body", ptr("héllo"), 1, 5)
+			},
+		},
+		{
+			name: "Missing and empty",
+			check: func(v *Validator) {
+				v.Required("email", nil)
+				v.Required("password", ptr("  "))
+			},
+			want: Errors{{"email", "is required"}, {"password", "is required"}},
+		},
+		{
+			name: "Rules skip missing values",
+			check: func(v *Validator) {
+				v.Email("email", nil)
+				v.Length("body", nil, 1, 5)
+			},
+		},
+		{
+			name: "Only the first error per field",
+			check: func(v *Validator) {
+				v.Required("email", ptr(""))
+				v.Email("email", ptr(""))
+			},
+			want: Errors{{"email", "is required"}},
+		},
+		{
+			name: "Invalid email",
+			check: func(v *Validator) {
+				v.Email("a", ptr("walt"))
+				v.Email("b", ptr("Walt <walt@example.com>"))
+			},
+			want: Errors{{"a", "must be a valid email address"}, {"b", "must be a valid email address"}},
+		},
+		{
+			name: "Length",
+			check: func(v *Validator) {
+				v.Length("short", ptr(""), 1, 5)
+				v.Length("long", ptr(strings.Repeat("é", 6)), 1, 5)
+			},
+			want: Errors{{"short", "must be at least 1 characters long"}, {"long", "must be at most 5 characters long"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Validator
+			tt.check(&v)
+			err := v.Err()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Err() = %v, want nil", err)
+				}
+				return
+			}
+			var got Errors
+			if !errors.As(err, &got) {
+				t.Fatalf("Err() = %v, want Errors", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Err() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
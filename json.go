@@ -2,30 +2,133 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"strings"
+
+	"github.com/jakubbortlik/chirpy/internal/validate"
 )
 
-func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
-	if err != nil {
-		log.Println(err)
+// maxBodyBytes caps the size of JSON request bodies.
+const maxBodyBytes = 1 << 20
+
+// decodeJSON decodes a single JSON object from the request body into dst,
+// rejecting unknown fields. On failure it responds with a client error and
+// returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	return decodeBody(w, r, dst, true)
+}
+
+// decodeWebhookJSON is like decodeJSON but ignores unknown fields, because
+// third parties may add fields to their payloads at any time.
+func decodeWebhookJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	return decodeBody(w, r, dst, false)
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any, strict bool) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	err := decoder.Decode(dst)
+	if err == nil && decoder.More() {
+		err = errors.New("trailing data after JSON object")
+	}
+	if err == nil {
+		return true
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		respondWithError(w, r, errBodyTooLarge, fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit), err)
+	case errors.Is(err, io.EOF):
+		respondWithError(w, r, errMalformedRequest, "Request body must not be empty", err)
+	case errors.As(err, &syntaxErr):
+		respondWithError(w, r, errMalformedRequest, fmt.Sprintf("Request body contains malformed JSON at position %d", syntaxErr.Offset), err)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		respondWithError(w, r, errMalformedRequest, "Request body contains malformed JSON", err)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		respondWithError(w, r, errMalformedRequest, fmt.Sprintf("Field %q must be of type %s", typeErr.Field, typeErr.Type), err)
+	case errors.As(err, &typeErr):
+		respondWithError(w, r, errMalformedRequest, "Request body must be a JSON object", err)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		respondWithError(w, r, errMalformedRequest, "Request body contains unknown field "+field, err)
+	default:
+		respondWithError(w, r, errMalformedRequest, "Request body must contain a single JSON object", err)
 	}
-	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
+	return false
+}
+
+// respondWithInvalid responds with 422 and the list of invalid fields if the
+// validator found any, and returns whether it did.
+func respondWithInvalid(w http.ResponseWriter, r *http.Request, v *validate.Validator) bool {
+	err := v.Err()
+	if err == nil {
+		return false
 	}
-	type errorResponse struct {
-		Error string `json:"error"`
+	var fields validate.Errors
+	errors.As(err, &fields)
+	requestLogger(r.Context()).Info("Responding with error", "status", errInvalidParameters.status, "code", errInvalidParameters.code, "error", err)
+	doc := newProblemDocument(r, errInvalidParameters, "")
+	doc.Fields = fields
+	writeJSON(w, doc.Status, "application/problem+json", doc)
+	return true
+}
+
+// problemDocument is the RFC 7807 body of error responses, extended with
+// the stable error code, the request ID and, for invalid parameters, the
+// list of invalid fields.
+type problemDocument struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail,omitempty"`
+	Instance  string                `json:"instance"`
+	Code      string                `json:"code"`
+	RequestID string                `json:"request_id,omitempty"`
+	Fields    []validate.FieldError `json:"fields,omitempty"`
+}
+
+func newProblemDocument(r *http.Request, p problem, detail string) problemDocument {
+	return problemDocument{
+		Type:      problemTypePrefix + p.code,
+		Title:     p.title,
+		Status:    p.status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      p.code,
+		RequestID: requestInfoFrom(r.Context()).id,
 	}
-	respondWithJSON(w, code, errorResponse{
-		Error: msg,
-	})
+}
+
+// respondWithError responds with the problem p. The detail is shown to the
+// client, so it must not contain internals; err is only logged.
+func respondWithError(w http.ResponseWriter, r *http.Request, p problem, detail string, err error) {
+	logger := requestLogger(r.Context())
+	if p.status > 499 {
+		logger.Error("Responding with 5XX error", "status", p.status, "code", p.code, "msg", detail, "error", err)
+	} else if err != nil {
+		logger.Info("Responding with error", "status", p.status, "code", p.code, "msg", detail, "error", err)
+	}
+	writeJSON(w, p.status, "application/problem+json", newProblemDocument(r, p, detail))
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload any) {
-	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, code, "application/json", payload)
+}
+
+func writeJSON(w http.ResponseWriter, code int, contentType string, payload any) {
+	w.Header().Set("Content-Type", contentType)
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error mashalling JSON: %s", err)
+		slog.Error("Error marshalling JSON", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/auth"
+	"github.com/jakubbortlik/chirpy/internal/database"
+)
+
+// loginPolicy decides how long an account or a client IP is locked out of
+// POST /api/login after repeated failed attempts. Delays are enforced by
+// locking rather than by sleeping so that attackers cannot tie up handlers.
+type loginPolicy struct {
+	FailureWindow   time.Duration
+	DelayAfter      int
+	Delay           time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	IPLockoutAfter  int
+}
+
+// Login events recorded for auditing.
+const (
+	loginEventSuccess  = "success"
+	loginEventFailure  = "failure"
+	loginEventBlocked  = "blocked"
+	loginEventLocked   = "locked"
+	loginEventUnlocked = "unlocked"
+)
+
+// accountLock returns how long an account stays locked after its n-th
+// consecutive failed login: nothing at first, then a delay that doubles with
+// every failure up to MaxDelay, then a full lockout.
+func (p loginPolicy) accountLock(failures int) time.Duration {
+	switch {
+	case failures >= p.LockoutAfter:
+		return p.LockoutDuration
+	case failures <= p.DelayAfter:
+		return 0
+	}
+	delay := p.Delay
+	for i := p.DelayAfter + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// ipLock returns how long a client IP stays locked after its n-th failed
+// login, whichever accounts the failures were for. IPs get no delays and a
+// much higher threshold than accounts, so that users behind a shared NAT are
+// rarely held up by each other.
+func (p loginPolicy) ipLock(failures int) time.Duration {
+	if failures >= p.IPLockoutAfter {
+		return p.LockoutDuration
+	}
+	return 0
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// dummyPasswordHash is compared against when the email is unknown so that
+// logins take as long for missing users as for existing ones.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := auth.HashPassword(uuid.NewString())
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// loginLockedFor returns how much longer any of the throttle keys is locked.
+func (cfg *apiConfig) loginLockedFor(ctx context.Context, keys ...string) (time.Duration, error) {
+	var locked time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		throttle, err := cfg.db.GetLoginThrottle(ctx, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if throttle.LockedUntil.Valid {
+			locked = max(locked, throttle.LockedUntil.Time.Sub(now))
+		}
+	}
+	return locked, nil
+}
+
+// recordLoginFailure counts a failed login against the account and the client
+// IP and locks whichever of them crossed a threshold. It reports whether the
+// account has just been locked out completely.
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, email, ip string) (bool, error) {
+	now := time.Now().UTC()
+	lockedOut := false
+	for _, t := range []struct {
+		key  string
+		lock func(int) time.Duration
+	}{
+		{accountThrottleKey(email), cfg.loginPolicy.accountLock},
+		{ipThrottleKey(ip), cfg.loginPolicy.ipLock},
+	} {
+		throttle, err := cfg.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Key:         t.key,
+			Now:         now,
+			WindowStart: now.Add(-cfg.loginPolicy.FailureWindow),
+		})
+		if err != nil {
+			return false, err
+		}
+		lock := t.lock(int(throttle.Failures))
+		if lock == 0 {
+			continue
+		}
+		err = cfg.db.LockLoginThrottle(ctx, database.LockLoginThrottleParams{
+			Key:         t.key,
+			LockedUntil: sql.NullTime{Time: now.Add(lock), Valid: true},
+		})
+		if err != nil {
+			return false, err
+		}
+		if t.key == accountThrottleKey(email) && int(throttle.Failures) == cfg.loginPolicy.LockoutAfter {
+			lockedOut = true
+		}
+	}
+	return lockedOut, nil
+}
+
+// recordLoginEvent stores an audit record of a login attempt. Failing to do
+// so is logged but does not fail the request.
+func (cfg *apiConfig) recordLoginEvent(r *http.Request, email string, userID uuid.UUID, event string) {
+	err := cfg.db.CreateLoginEvent(r.Context(), database.CreateLoginEventParams{
+		Email:  email,
+		UserID: uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil},
+		Ip:     cfg.clientIP(r),
+		Event:  event,
+	})
+	if err != nil {
+		requestLogger(r.Context()).Error("Recording login event failed", "event", event, "error", err)
+	}
+}
+
+// loginThrottleCleanup periodically forgets throttles that have neither
+// recent failures nor an active lock. It runs as a background worker.
+func (cfg *apiConfig) loginThrottleCleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := time.Now().UTC().Add(-cfg.loginPolicy.FailureWindow)
+			if err := cfg.db.DeleteIdleLoginThrottles(ctx, before); err != nil && ctx.Err() == nil {
+				slog.Error("Cleaning up login throttles failed", "error", err)
+			}
+		}
+	}
+}
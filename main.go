@@ -1,78 +1,193 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/jakubbortlik/chirpy/internal/config"
+	"github.com/jakubbortlik/chirpy/internal/cors"
+	"github.com/jakubbortlik/chirpy/internal/migrate"
+	"github.com/jakubbortlik/chirpy/internal/ratelimit"
+	"github.com/jakubbortlik/chirpy/internal/store"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	JWTSecret      string
-	PolkaKey       string
+	fileserverHits    atomic.Int32
+	draining          atomic.Bool
+	workerCtx         context.Context
+	stopWorkers       context.CancelFunc
+	workers           sync.WaitGroup
+	db                store.Store
+	metrics           *metrics
+	rateLimiter       ratelimit.Backend
+	rateLimits        map[string]ratelimit.Limit
+	trustProxyHeaders bool
+	cors              cors.Options
+	loginPolicy       loginPolicy
+	platform          string
+	JWTSecret         string
+	PolkaKey          string
+	AccessTokenTTL    time.Duration
+	RefreshTokenTTL   time.Duration
+	MaxChirpLength    int
 }
 
 func main() {
 	godotenv.Load()
 
-	const filepathRoot = "."
-	const port = "8080"
-
-	fs := http.FileServer(http.Dir(filepathRoot))
-	apiCfg := &apiConfig{
-		JWTSecret: os.Getenv("JWT_SECRET"),
-		PolkaKey:  os.Getenv("POLKA_KEY"),
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			runMigrate(args[1:])
+			return
+		case "admin":
+			runAdmin(args[1:])
+			return
+		}
 	}
+	serve(args)
+}
 
-	mux := http.NewServeMux()
-	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app/", fs)))
+// loadConfig loads the configuration or exits, printing the usage when asked
+// for it with -h.
+func loadConfig(args []string, usage string) config.Config {
+	conf, err := config.Load(args, os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(os.Stderr, "Usage: %s\n\nFlags:\n", usage)
+		config.Usage(os.Stderr)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(newLogger(conf))
+	return conf
+}
 
-	mux.HandleFunc("GET /api/healthz", handlerReadiness)
-	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
-		handlerPostChirp(w, r, apiCfg)
-	})
-	mux.HandleFunc("GET /api/chirps", handlerGetChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", handlerGetIndividualChirp)
+func serve(args []string) {
+	conf := loadConfig(args, "chirpy [flags]\n       chirpy migrate up|down|status|redo [flags]\n       chirpy admin promote|demote <email> [flags]")
 
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
-		handlerDeleteChirp(w, r, apiCfg)
-	})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	mux.HandleFunc("POST /api/users", handlerCreateUser)
-	mux.HandleFunc("PUT /api/users", func(w http.ResponseWriter, r *http.Request) {
-		handlerUpdateUser(w, r, apiCfg)
-	})
+	m := newMetrics()
+	var db store.Store
+	var rateLimiter ratelimit.Backend = ratelimit.NewMemory()
+	switch conf.Store {
+	case "memory":
+		slog.Warn("Using in-memory store, data will be lost on restart")
+		db = store.NewMemory()
+	default:
+		dbPool, err := openDB(ctx, conf)
+		if err != nil {
+			fatal("Connecting to database failed", "error", err)
+		}
+		if conf.MigrateOnStartup {
+			applied, err := migrate.Up(ctx, dbPool)
+			if err != nil {
+				fatal("Migrating database failed", "error", err)
+			}
+			slog.Info("Migrated database", "applied", applied)
+		}
+		m.registry.MustRegister(collectors.NewDBStatsCollector(dbPool, "chirpy"))
+		db = store.NewPostgres(dbPool, m.observeQuery)
+		if conf.RateLimitBackend == "postgres" {
+			rateLimiter = ratelimit.NewPostgres(dbPool)
+		}
+	}
 
-	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
-		handlerUserLogin(w, r, apiCfg)
-	})
-	mux.HandleFunc("POST /api/refresh", func(w http.ResponseWriter, r *http.Request) {
-		handlerRefreshToken(w, r, apiCfg)
-	})
-	mux.HandleFunc("POST /api/revoke", handlerRevokeToken)
+	apiCfg := newAPIConfig(conf, db, rateLimiter, m)
+	handler, err := apiCfg.routes(conf.FilepathRoot)
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	apiCfg.startWorker(apiCfg.rateLimitCleanup)
+	apiCfg.startWorker(apiCfg.loginThrottleCleanup)
+	server := &http.Server{
+		Addr:    conf.ListenAddr,
+		Handler: handler,
+	}
 
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Serving", "filepath_root", conf.FilepathRoot, "addr", conf.ListenAddr)
+		serverErr <- server.ListenAndServe()
+	}()
 
-	mux.HandleFunc("POST /api/polka/webhooks", func(w http.ResponseWriter, r *http.Request) {
-		handlerUpgradeUser(w, r, apiCfg)
-	})
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal("Serving failed", "error", err)
+		}
+	case <-ctx.Done():
+		stop()
+		shutdown(server, apiCfg, conf)
+	}
+}
 
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+func newAPIConfig(conf config.Config, db store.Store, rateLimiter ratelimit.Backend, m *metrics) *apiConfig {
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	return &apiConfig{
+		workerCtx:         workerCtx,
+		stopWorkers:       stopWorkers,
+		db:                db,
+		metrics:           m,
+		rateLimiter:       rateLimiter,
+		rateLimits:        conf.RateLimits,
+		trustProxyHeaders: conf.TrustProxyHeaders,
+		cors:              conf.CORS,
+		loginPolicy: loginPolicy{
+			FailureWindow:   conf.LoginFailureWindow,
+			DelayAfter:      conf.LoginDelayAfter,
+			Delay:           conf.LoginDelay,
+			MaxDelay:        conf.LoginMaxDelay,
+			LockoutAfter:    conf.LoginLockoutAfter,
+			LockoutDuration: conf.LoginLockoutDuration,
+			IPLockoutAfter:  conf.LoginIPLockoutAfter,
+		},
+		platform:        conf.Platform,
+		JWTSecret:       conf.JWTSecret,
+		PolkaKey:        conf.PolkaKey,
+		AccessTokenTTL:  conf.AccessTokenTTL,
+		RefreshTokenTTL: conf.RefreshTokenTTL,
+		MaxChirpLength:  conf.MaxChirpLength,
 	}
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(server.ListenAndServe())
 }
 
-func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileserverHits.Add(1)
-		next.ServeHTTP(w, r)
-	})
+// shutdown reports unhealthy for conf.ShutdownDelay so that load balancers
+// stop routing to us, then waits up to conf.ShutdownTimeout for in-flight
+// requests before stopping background workers and closing the database.
+func shutdown(server *http.Server, cfg *apiConfig, conf config.Config) {
+	slog.Info("Shutting down, draining connections")
+	cfg.draining.Store(true)
+	time.Sleep(conf.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Draining connections failed", "error", err)
+	}
+
+	cfg.stopWorkers()
+	cfg.workers.Wait()
+
+	if err := cfg.db.Close(); err != nil {
+		slog.Error("Closing database failed", "error", err)
+	}
+	slog.Info("Shutdown complete")
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds the Prometheus collectors exposed on GET /metrics. Each
+// apiConfig gets its own registry so that tests can run in parallel.
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	queryDuration   *prometheus.HistogramVec
+	queryErrors     *prometheus.CounterVec
+	logins          *prometheus.CounterVec
+	chirpsCreated   prometheus.Counter
+	webhookEvents   *prometheus.CounterVec
+	rateLimited     *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_http_requests_total",
+			Help: "HTTP requests served, by route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "chirpy_http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by route pattern and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "chirpy_db_query_duration_seconds",
+			Help:    "Time taken by database queries, by sqlc query name.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"query"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_db_query_errors_total",
+			Help: "Database queries that returned an error, by sqlc query name.",
+		}, []string{"query"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_logins_total",
+			Help: "Login attempts, by result.",
+		}, []string{"result"}),
+		chirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chirpy_chirps_created_total",
+			Help: "Chirps created.",
+		}),
+		webhookEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_webhook_events_total",
+			Help: "Polka webhook events received, by event and result.",
+		}, []string{"event", "result"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_rate_limited_requests_total",
+			Help: "Requests rejected by rate limiting, by route pattern.",
+		}, []string{"route"}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.queryDuration,
+		m.queryErrors,
+		m.logins,
+		m.chirpsCreated,
+		m.webhookEvents,
+		m.rateLimited,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// observeQuery is a store.QueryObserver.
+func (m *metrics) observeQuery(name string, duration time.Duration, err error) {
+	m.queryDuration.WithLabelValues(name).Observe(duration.Seconds())
+	if err != nil {
+		m.queryErrors.WithLabelValues(name).Inc()
+	}
+}
+
+// webhookEvent records a Polka event. Unknown event names are folded into
+// "other" so that callers cannot create arbitrary label values.
+func (m *metrics) webhookEvent(event, result string) {
+	if event != "user.upgraded" {
+		event = "other"
+	}
+	m.webhookEvents.WithLabelValues(event, result).Inc()
+}
+
+// middlewareInstrument must wrap the mux directly so that r.Pattern is set
+// once the request has been routed.
+func (cfg *apiConfig) middlewareInstrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		method, route := r.Method, r.Pattern
+		if route == "" {
+			// The method of an unrouted request can be anything at all.
+			method, route = "other", "unmatched"
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		status := strconv.Itoa(rec.status)
+		cfg.metrics.requests.WithLabelValues(method, route, status).Inc()
+		cfg.metrics.requestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
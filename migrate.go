@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"github.com/jakubbortlik/chirpy/internal/migrate"
+)
+
+// runMigrate implements `chirpy migrate up|down|status|redo [flags]`.
+func runMigrate(args []string) {
+	const usage = "chirpy migrate up|down|status|redo [flags]"
+	if len(args) == 0 || !slices.Contains(migrate.Commands, args[0]) {
+		loadConfig([]string{"-h"}, usage)
+	}
+	command := args[0]
+	conf := loadConfig(args[1:], usage)
+	if conf.Store != "postgres" {
+		fatal("Migrations need STORE=postgres", "store", conf.Store)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := openDB(ctx, conf)
+	if err != nil {
+		fatal("Connecting to database failed", "error", err)
+	}
+	defer db.Close()
+
+	if err := migrate.Run(ctx, db, command, os.Stdout); err != nil {
+		fatal("Migrating database failed", "command", command, "error", err)
+	}
+}
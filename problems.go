@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jakubbortlik/chirpy/internal/auth"
+)
+
+// problem is a class of error responses, rendered as an RFC 7807 problem
+// document. Codes are part of the API: clients switch on them, so they must
+// never change once released. Every problem is listed in docs/errors.md.
+type problem struct {
+	status int
+	code   string
+	title  string
+}
+
+// problemTypePrefix turns a code into the problem type URI.
+const problemTypePrefix = "urn:chirpy:error:"
+
+var (
+	errMalformedRequest   = problem{400, "malformed_request", "Malformed request body"}
+	errInvalidID          = problem{400, "invalid_id", "Invalid ID"}
+	errMissingToken       = problem{401, "missing_token", "Missing bearer token"}
+	errInvalidToken       = problem{401, "invalid_token", "Invalid token"}
+	errTokenExpired       = problem{401, "token_expired", "Token expired"}
+	errTokenRevoked       = problem{401, "token_revoked", "Token revoked"}
+	errInvalidAPIKey      = problem{401, "invalid_api_key", "Invalid API key"}
+	errInvalidCredentials = problem{401, "invalid_credentials", "Incorrect email or password"}
+	errForbidden          = problem{403, "forbidden", "Forbidden"}
+	errForbiddenNotOwner  = problem{403, "forbidden_not_owner", "Not the owner of the resource"}
+	errForbiddenNotAdmin  = problem{403, "forbidden_not_admin", "Admin role required"}
+	errChirpNotFound      = problem{404, "chirp_not_found", "Chirp not found"}
+	errUserNotFound       = problem{404, "user_not_found", "User not found"}
+	errEmailTaken         = problem{409, "email_taken", "Email already registered"}
+	errHandleTaken        = problem{409, "handle_taken", "Handle already taken"}
+	errBodyTooLarge       = problem{413, "body_too_large", "Request body too large"}
+	errInvalidParameters  = problem{422, "invalid_parameters", "Invalid request parameters"}
+	errRateLimited        = problem{429, "rate_limited", "Too many requests"}
+	errLoginLocked        = problem{429, "login_locked", "Too many failed login attempts"}
+	errInternal           = problem{500, "internal_error", "Internal server error"}
+)
+
+// tokenProblem maps errors from extracting and validating a bearer token.
+func tokenProblem(err error) problem {
+	switch {
+	case errors.Is(err, auth.ErrNoAuthHeader):
+		return errMissingToken
+	case errors.Is(err, auth.ErrTokenExpired):
+		return errTokenExpired
+	default:
+		return errInvalidToken
+	}
+}
+
+// storeProblem maps a store error to notFound when the row does not exist
+// and to an internal error otherwise.
+func storeProblem(err error, notFound problem) problem {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+	return errInternal
+}
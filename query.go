@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jakubbortlik/chirpy/internal/validate"
+)
+
+// queryInt returns the query parameter name as an integer between min and
+// max, or def when it is absent. Invalid values are recorded in v.
+func queryInt(v *validate.Validator, r *http.Request, name string, def, min, max int) int {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	v.Check(err == nil && n >= min && n <= max, name, fmt.Sprintf("must be an integer between %d and %d", min, max))
+	return n
+}
+
+// queryDuration returns the query parameter name as a Go duration between
+// min and max, or def when it is absent. Invalid values are recorded in v.
+func queryDuration(v *validate.Validator, r *http.Request, name string, def, min, max time.Duration) time.Duration {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	v.Check(err == nil && d >= min && d <= max, name, fmt.Sprintf("must be a duration between %s and %s", min, max))
+	return d
+}
+
+// queryTime returns the query parameter name parsed as an RFC 3339
+// timestamp in UTC. It is invalid when absent or malformed; malformed values
+// are recorded in v.
+func queryTime(v *validate.Validator, r *http.Request, name string) sql.NullTime {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return sql.NullTime{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	v.Check(err == nil, name, "must be an RFC 3339 timestamp")
+	return sql.NullTime{Time: t.UTC(), Valid: err == nil}
+}
+
+// queryUUIDs returns every UUID in the query parameter name, which may be
+// repeated and may hold a comma-separated list. Invalid values are recorded
+// in v.
+func queryUUIDs(v *validate.Validator, r *http.Request, name string) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, value := range r.URL.Query()[name] {
+		for _, s := range strings.Split(value, ",") {
+			id, err := uuid.Parse(strings.TrimSpace(s))
+			v.Check(err == nil, name, "must be a comma-separated list of UUIDs")
+			if err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jakubbortlik/chirpy/internal/auth"
+)
+
+// middlewareRateLimit enforces the limit configured for pattern, if any.
+// Callers with a valid access token are limited per user, everyone else per
+// client IP.
+func (cfg *apiConfig) middlewareRateLimit(pattern string, next http.Handler) http.Handler {
+	limit, ok := cfg.rateLimits[pattern]
+	if !ok {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := cfg.rateLimiter.Take(r.Context(), pattern+"|"+cfg.rateLimitKey(r), limit)
+		if err != nil {
+			// Fail open: an unavailable limiter must not take the API down.
+			requestLogger(r.Context()).Error("Rate limiting failed", "route", pattern, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", ceilSeconds(res.Reset))
+		w.Header().Set("RateLimit-Policy", strconv.Itoa(limit.Burst)+";w="+ceilSeconds(limit.Period))
+		if !res.Allowed {
+			cfg.metrics.rateLimited.WithLabelValues(pattern).Inc()
+			w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+			respondWithError(w, r, errRateLimited, "", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (cfg *apiConfig) rateLimitKey(r *http.Request) string {
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		if userID, err := auth.ValidateJWT(token, cfg.JWTSecret); err == nil {
+			return "user:" + userID.String()
+		}
+	}
+	return "ip:" + cfg.clientIP(r)
+}
+
+// clientIP returns the address of the client. Behind a proxy, enable
+// TrustProxyHeaders and the right-most X-Forwarded-For entry, the one added
+// by our own proxy, is used instead of the proxy's address.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.trustProxyHeaders {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			hops := strings.Split(xff[len(xff)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimitCleanup periodically forgets idle buckets so that the backend does
+// not grow without bound. It runs as a background worker.
+func (cfg *apiConfig) rateLimitCleanup(ctx context.Context) {
+	var idle time.Duration
+	for _, limit := range cfg.rateLimits {
+		idle = max(idle, limit.Period)
+	}
+	if idle == 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.rateLimiter.Cleanup(ctx, idle); err != nil && ctx.Err() == nil {
+				slog.Error("Cleaning up rate limit buckets failed", "error", err)
+			}
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -2,8 +2,12 @@ package main
 
 import "net/http"
 
-func handlerReadiness(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerReadiness(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	if cfg.draining.Load() {
+		status = http.StatusServiceUnavailable
+	}
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(http.StatusText(http.StatusOK)))
+	w.WriteHeader(status)
+	w.Write([]byte(http.StatusText(status)))
 }
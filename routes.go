@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// routes builds the handler for every route. It fails if a rate limit is
+// configured for a pattern that no route has, which is most likely a typo
+// that would otherwise leave the route unlimited.
+func (cfg *apiConfig) routes(filepathRoot string) (http.Handler, error) {
+	fs := http.FileServer(http.Dir(filepathRoot))
+
+	mux := http.NewServeMux()
+	var patterns []string
+	// handle registers an API or admin route behind the rate limit configured for
+	// its pattern, authenticating callers as required by req.
+	handle := func(pattern string, req authRequirement, handler http.HandlerFunc) {
+		patterns = append(patterns, pattern)
+		mux.Handle(pattern, cfg.middlewareRateLimit(pattern, cfg.middlewareAuth(req, handler)))
+	}
+
+	mux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app/", fs)))
+
+	mux.HandleFunc("GET /api/healthz", cfg.handlerReadiness)
+	mux.Handle("GET /metrics", cfg.metrics.handler())
+	handle("POST /api/chirps", authRequired, cfg.handlerPostChirp)
+	handle("GET /api/chirps", authOptional, cfg.handlerGetChirps)
+	handle("GET /api/chirps/search", authOptional, cfg.handlerSearchChirps)
+	handle("GET /api/chirps/{chirpID}", authOptional, cfg.handlerGetIndividualChirp)
+	handle("PUT /api/chirps/{chirpID}", authRequired, cfg.handlerUpdateChirp)
+	handle("DELETE /api/chirps/{chirpID}", authRequired, cfg.handlerDeleteChirp)
+	handle("GET /api/chirps/{chirpID}/revisions", authOptional, cfg.handlerGetChirpRevisions)
+	handle("GET /api/chirps/{chirpID}/thread", authOptional, cfg.handlerGetChirpThread)
+	handle("POST /api/chirps/{chirpID}/likes", authRequired, cfg.handlerLikeChirp)
+	handle("DELETE /api/chirps/{chirpID}/likes", authRequired, cfg.handlerUnlikeChirp)
+
+	handle("GET /api/tags/trending", authNone, cfg.handlerGetTrendingTags)
+	handle("GET /api/tags/{tag}/chirps", authOptional, cfg.handlerGetTagChirps)
+
+	handle("POST /api/users", authNone, cfg.handlerCreateUser)
+	handle("PUT /api/users", authRequired, cfg.handlerUpdateUser)
+	handle("GET /api/users/me/mentions", authRequired, cfg.handlerGetMentions)
+	handle("GET /api/users/{handle}", authNone, cfg.handlerGetProfile)
+	handle("POST /api/users/{handle}/followers", authRequired, cfg.handlerFollowUser)
+	handle("DELETE /api/users/{handle}/followers", authRequired, cfg.handlerUnfollowUser)
+	handle("GET /api/users/{userID}/likes", authOptional, cfg.handlerGetUserLikes)
+
+	handle("POST /api/login", authNone, cfg.handlerUserLogin)
+	handle("POST /api/refresh", authNone, cfg.handlerRefreshToken)
+	handle("POST /api/revoke", authNone, cfg.handlerRevokeToken)
+
+	handle("GET /admin/metrics", authAdmin, cfg.handlerMetrics)
+	handle("POST /admin/reset", authAdmin, cfg.handlerReset)
+	handle("GET /admin/users", authAdmin, cfg.handlerAdminListUsers)
+	handle("GET /admin/users/{userID}", authAdmin, cfg.handlerAdminGetUser)
+	handle("GET /admin/users/{userID}/chirps", authAdmin, cfg.handlerAdminGetUserChirps)
+	handle("GET /admin/users/{userID}/refresh_tokens", authAdmin, cfg.handlerAdminGetUserRefreshTokens)
+	handle("PUT /admin/users/{userID}/chirpy_red", authAdmin, cfg.handlerAdminSetChirpyRed)
+	handle("POST /admin/users/{userID}/unlock", authAdmin, cfg.handlerUnlockUser)
+
+	handle("POST /api/polka/webhooks", authNone, cfg.handlerUpgradeUser)
+
+	var errs []error
+	for _, pattern := range slices.Sorted(maps.Keys(cfg.rateLimits)) {
+		if !slices.Contains(patterns, pattern) {
+			errs = append(errs, fmt.Errorf("RATE_LIMITS: %q matches no route", pattern))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return cfg.middlewareLogging(cfg.middlewareInstrument(cfg.middlewareCORS(mux))), nil
+}
+
+// middlewareCORS lets browsers on other origins call /api. It runs in front
+// of the mux because preflight OPTIONS requests match no route. The admin
+// endpoints and the app stay same-origin only.
+func (cfg *apiConfig) middlewareCORS(next http.Handler) http.Handler {
+	withCORS := cfg.cors.Handler(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			withCORS.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.fileserverHits.Add(1)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,30 @@
+-- name: LikeChirp :exec
+INSERT INTO chirp_likes (chirp_id, user_id, created_at)
+VALUES (
+    $1, $2, NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: UnlikeChirp :exec
+DELETE FROM chirp_likes
+WHERE chirp_id = $1 AND user_id = $2;
+
+-- name: GetLikedChirpIDs :many
+-- GetLikedChirpIDs returns which of chirp_ids user_id likes, so that a page
+-- of chirps needs a single query.
+SELECT chirp_id FROM chirp_likes
+WHERE user_id = sqlc.arg(user_id) AND chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: ListLikedChirps :many
+-- ListLikedChirps returns a page of the chirps a user likes, most recently
+-- liked first. before_* is an exclusive keyset bound on (liked_at, id).
+SELECT sqlc.embed(chirps), chirp_likes.created_at AS liked_at
+FROM chirp_likes
+JOIN chirps ON chirps.id = chirp_likes.chirp_id
+WHERE chirp_likes.user_id = sqlc.arg(user_id)
+AND (
+    sqlc.narg(before_liked_at)::timestamp IS NULL
+    OR (chirp_likes.created_at, chirp_likes.chirp_id) < (sqlc.narg(before_liked_at), sqlc.narg(before_id)::uuid)
+)
+ORDER BY chirp_likes.created_at DESC, chirp_likes.chirp_id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,35 @@
+-- name: SetChirpMentions :exec
+-- SetChirpMentions replaces the users a chirp mentions with the users whose
+-- handles, lower-cased, are in handles. Unknown handles are ignored.
+WITH mentioned AS (
+    SELECT id, handle FROM users
+    WHERE lower(handle) = ANY(sqlc.arg(handles)::text[])
+), removed AS (
+    DELETE FROM chirp_mentions
+    WHERE chirp_id = sqlc.arg(chirp_id) AND user_id NOT IN (SELECT id FROM mentioned)
+)
+INSERT INTO chirp_mentions (chirp_id, user_id, handle, created_at)
+SELECT chirps.id, mentioned.id, mentioned.handle, chirps.created_at
+FROM chirps, mentioned
+WHERE chirps.id = sqlc.arg(chirp_id)
+ON CONFLICT (chirp_id, user_id) DO UPDATE SET handle = EXCLUDED.handle;
+
+-- name: GetChirpMentions :many
+-- GetChirpMentions returns the users chirp_ids mention, so that a page of
+-- chirps needs a single query.
+SELECT chirp_id, user_id, handle FROM chirp_mentions
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: ListMentions :many
+-- ListMentions returns a page of the chirps that mention a user, newest
+-- first. before_* is an exclusive keyset bound.
+SELECT chirps.*
+FROM chirp_mentions
+JOIN chirps ON chirps.id = chirp_mentions.chirp_id
+WHERE chirp_mentions.user_id = sqlc.arg(user_id)
+AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (chirp_mentions.created_at, chirp_mentions.chirp_id) < (sqlc.narg(before_created_at), sqlc.narg(before_id)::uuid)
+)
+ORDER BY chirp_mentions.created_at DESC, chirp_mentions.chirp_id DESC
+LIMIT sqlc.arg('limit');
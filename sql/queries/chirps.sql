@@ -1,15 +1,10 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id, is_reply, rechirp_of, quote_of, is_quote)
 VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $3 IS NOT NULL, $4, $5, $5 IS NOT NULL
 )
 RETURNING *;
 
--- name: GetChirps :many
-SELECT * FROM chirps
-WHERE user_id = $1 OR $1 = '00000000-0000-0000-0000-000000000000'
-ORDER BY created_at ASC;
-
 -- name: GetChirp :one
 SELECT * FROM chirps
 WHERE id = $1;
@@ -17,3 +12,132 @@ WHERE id = $1;
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
+
+-- name: ListChirps :many
+-- ListChirps returns a page of chirps in (created_at, id) order. An empty
+-- or null author_ids matches every author; the other filters apply when not
+-- null. after_* and before_* are exclusive keyset bounds.
+SELECT * FROM chirps
+WHERE (coalesce(cardinality(sqlc.arg(author_ids)::uuid[]), 0) = 0 OR user_id = ANY(sqlc.arg(author_ids)::uuid[]))
+AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since))
+AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until))
+AND (
+    sqlc.narg(after_created_at)::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg(after_created_at), sqlc.narg(after_id)::uuid)
+)
+AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.narg(before_id)::uuid)
+)
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+-- ListChirpsDesc is ListChirps in reverse order.
+SELECT * FROM chirps
+WHERE (coalesce(cardinality(sqlc.arg(author_ids)::uuid[]), 0) = 0 OR user_id = ANY(sqlc.arg(author_ids)::uuid[]))
+AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since))
+AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until))
+AND (
+    sqlc.narg(after_created_at)::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg(after_created_at), sqlc.narg(after_id)::uuid)
+)
+AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.narg(before_id)::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirps :many
+-- SearchChirps returns a page of chirps matching query, a to_tsquery
+-- expression, best match first. before_* is an exclusive keyset bound.
+SELECT sqlc.embed(chirps), ts_rank(to_tsvector('english', body), to_tsquery('english', sqlc.arg(query)))::real AS rank
+FROM chirps
+WHERE to_tsvector('english', body) @@ to_tsquery('english', sqlc.arg(query))
+AND (coalesce(cardinality(sqlc.arg(author_ids)::uuid[]), 0) = 0 OR user_id = ANY(sqlc.arg(author_ids)::uuid[]))
+AND (
+    sqlc.narg(before_rank)::real IS NULL
+    OR (ts_rank(to_tsvector('english', body), to_tsquery('english', sqlc.arg(query))), created_at, id)
+        < (sqlc.narg(before_rank), sqlc.narg(before_created_at)::timestamp, sqlc.narg(before_id)::uuid)
+)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirpsRecent :many
+-- SearchChirpsRecent is SearchChirps ordered newest first.
+SELECT * FROM chirps
+WHERE to_tsvector('english', body) @@ to_tsquery('english', sqlc.arg(query))
+AND (coalesce(cardinality(sqlc.arg(author_ids)::uuid[]), 0) = 0 OR user_id = ANY(sqlc.arg(author_ids)::uuid[]))
+AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.narg(before_id)::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: UpdateChirp :one
+-- UpdateChirp replaces the body of a chirp, keeping the previous body in
+-- chirp_revisions.
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+    SELECT gen_random_uuid(), id, body, updated_at, NOW()
+    FROM chirps
+    WHERE chirps.id = sqlc.arg(id)
+)
+UPDATE chirps
+SET body = sqlc.arg(body), updated_at = NOW()
+WHERE chirps.id = sqlc.arg(id)
+RETURNING *;
+
+-- name: GetChirpAncestors :many
+-- GetChirpAncestors returns the chirps a chirp replies to, directly or
+-- not, starting with the one that starts the thread.
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.parent_id, 1 AS depth
+    FROM chirps AS parent
+    JOIN chirps AS child ON child.parent_id = parent.id
+    WHERE child.id = sqlc.arg(id)
+    UNION ALL
+    SELECT chirps.id, chirps.parent_id, ancestors.depth + 1
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.parent_id
+)
+SELECT chirps.* FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC;
+
+-- name: GetChirpDescendants :many
+-- GetChirpDescendants returns a page of the replies below a chirp in thread
+-- order: every reply is followed by the replies to it, and replies to the
+-- same chirp are oldest first. path is the position of a reply in that order
+-- and after_path, when not empty, the exclusive keyset bound.
+WITH RECURSIVE descendants AS (
+    SELECT chirps.id, 1 AS depth,
+        ARRAY[to_char(chirps.created_at, 'YYYYMMDDHH24MISSUS') || chirps.id::text] AS path
+    FROM chirps
+    WHERE chirps.parent_id = sqlc.arg(id)::uuid
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1,
+        descendants.path || (to_char(chirps.created_at, 'YYYYMMDDHH24MISSUS') || chirps.id::text)
+    FROM chirps
+    JOIN descendants ON chirps.parent_id = descendants.id
+)
+SELECT sqlc.embed(chirps), descendants.depth::integer AS depth, descendants.path::text[] AS path
+FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+WHERE coalesce(cardinality(sqlc.arg(after_path)::text[]), 0) = 0 OR descendants.path > sqlc.arg(after_path)::text[]
+ORDER BY descendants.path
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: GetRechirp :one
+SELECT * FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2;
+
+-- name: CountUserChirps :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1;
@@ -0,0 +1,36 @@
+-- name: GetLoginThrottle :one
+SELECT * FROM login_throttles
+WHERE key = $1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (key, failures, last_failure_at)
+VALUES (
+    @key, 1, @now
+)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failure_at < @window_start THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failure_at = @now
+RETURNING *;
+
+-- name: LockLoginThrottle :exec
+UPDATE login_throttles
+SET locked_until = $2
+WHERE key = $1;
+
+-- name: DeleteLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE key = $1;
+
+-- name: DeleteIdleLoginThrottles :exec
+DELETE FROM login_throttles
+WHERE last_failure_at < @before
+AND (locked_until IS NULL OR locked_until < @before);
+
+-- name: CreateLoginEvent :exec
+INSERT INTO login_events (id, created_at, email, user_id, ip, event)
+VALUES (
+    gen_random_uuid(), NOW(), $1, $2, $3, $4
+);
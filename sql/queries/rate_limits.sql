@@ -0,0 +1,21 @@
+-- name: TakeRateLimitToken :one
+-- Refills the bucket for the time elapsed since it was last used and takes a
+-- token if there is one, all in a single statement so that concurrent
+-- requests on different instances cannot both take the last token.
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+VALUES (
+    sqlc.arg(key), sqlc.arg(burst)::float8 - 1, true, NOW()
+)
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+        WHEN LEAST(sqlc.arg(burst)::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * sqlc.arg(rate)::float8) >= 1
+        THEN LEAST(sqlc.arg(burst)::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * sqlc.arg(rate)::float8) - 1
+        ELSE LEAST(sqlc.arg(burst)::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * sqlc.arg(rate)::float8)
+    END,
+    allowed = LEAST(sqlc.arg(burst)::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * sqlc.arg(rate)::float8) >= 1,
+    updated_at = NOW()
+RETURNING tokens, allowed;
+
+-- name: DeleteIdleRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets
+WHERE updated_at < NOW() - sqlc.arg(idle_seconds)::float8 * INTERVAL '1 second';
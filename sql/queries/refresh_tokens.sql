@@ -16,3 +16,8 @@ WHERE token = $1;
 -- name: GetUserFromRefreshToken :one
 SELECT user_id FROM refresh_tokens
 WHERE token = $1;
+
+-- name: GetRefreshTokensForUser :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC;
@@ -0,0 +1,52 @@
+-- name: SetChirpTags :exec
+-- SetChirpTags replaces the tags of a chirp with names, creating the tags
+-- that do not exist yet. names must not contain duplicates.
+WITH chirp_tag_ids AS (
+    INSERT INTO tags (id, name, created_at)
+    SELECT gen_random_uuid(), name, NOW()
+    FROM unnest(sqlc.arg(names)::text[]) AS name
+    ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+    RETURNING id
+), removed AS (
+    DELETE FROM chirp_tags
+    WHERE chirp_id = sqlc.arg(chirp_id) AND tag_id NOT IN (SELECT id FROM chirp_tag_ids)
+)
+INSERT INTO chirp_tags (chirp_id, tag_id, created_at)
+SELECT chirps.id, chirp_tag_ids.id, chirps.created_at
+FROM chirps, chirp_tag_ids
+WHERE chirps.id = sqlc.arg(chirp_id)
+ON CONFLICT DO NOTHING;
+
+-- name: GetChirpTags :many
+-- GetChirpTags returns the tags of chirp_ids, so that a page of chirps
+-- needs a single query.
+SELECT chirp_tags.chirp_id, tags.name
+FROM chirp_tags
+JOIN tags ON tags.id = chirp_tags.tag_id
+WHERE chirp_tags.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY tags.name;
+
+-- name: ListTagChirps :many
+-- ListTagChirps returns a page of the chirps tagged with a tag, newest
+-- first. before_* is an exclusive keyset bound.
+SELECT chirps.*
+FROM chirp_tags
+JOIN tags ON tags.id = chirp_tags.tag_id
+JOIN chirps ON chirps.id = chirp_tags.chirp_id
+WHERE tags.name = sqlc.arg(tag)
+AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (chirp_tags.created_at, chirp_tags.chirp_id) < (sqlc.narg(before_created_at), sqlc.narg(before_id)::uuid)
+)
+ORDER BY chirp_tags.created_at DESC, chirp_tags.chirp_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: TrendingTags :many
+-- TrendingTags returns the tags of the most chirps posted since a time.
+SELECT tags.name, COUNT(*) AS chirp_count
+FROM chirp_tags
+JOIN tags ON tags.id = chirp_tags.tag_id
+WHERE chirp_tags.created_at >= sqlc.arg(since)
+GROUP BY tags.name
+ORDER BY chirp_count DESC, tags.name
+LIMIT sqlc.arg('limit');
@@ -10,9 +10,16 @@ SELECT * FROM users
 WHERE email = $1;
 
 -- name: UpdateUser :one
+-- UpdateUser keeps the handle and each profile field that is null.
 UPDATE users
-SET email = $2, hashed_password = $3
-WHERE id = $1
+SET email = sqlc.arg(email),
+    hashed_password = sqlc.arg(hashed_password),
+    handle = coalesce(sqlc.narg(handle), handle),
+    display_name = coalesce(sqlc.narg(display_name), display_name),
+    bio = coalesce(sqlc.narg(bio), bio),
+    website = coalesce(sqlc.narg(website), website),
+    avatar_url = coalesce(sqlc.narg(avatar_url), avatar_url)
+WHERE id = sqlc.arg(id)
 RETURNING *;
 
 -- name: UpgradeUser :one
@@ -20,3 +27,37 @@ UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1
 RETURNING *;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE lower(handle) = lower(sqlc.arg(handle));
+
+-- name: GetUserHandles :many
+-- GetUserHandles returns the handles of the users with the given ids, so
+-- that a page of chirps needs a single query for its authors.
+SELECT id, handle FROM users
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: ListUsers :many
+-- ListUsers returns the users whose email contains query in any case,
+-- oldest first. query is plain text, not a LIKE pattern.
+SELECT * FROM users
+WHERE strpos(lower(email), lower(sqlc.arg(query)::text)) > 0
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: SetUserAdmin :one
+UPDATE users
+SET is_admin = $2, updated_at = NOW()
+WHERE email = $1
+RETURNING *;
+
+-- name: SetChirpyRed :one
+UPDATE users
+SET is_chirpy_red = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE rate_limit_buckets (
+    key text PRIMARY KEY,
+    tokens double precision NOT NULL,
+    allowed boolean NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS rate_limit_buckets;
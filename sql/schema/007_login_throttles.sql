@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE login_throttles (
+    key text PRIMARY KEY,
+    failures integer NOT NULL,
+    last_failure_at timestamp NOT NULL,
+    locked_until timestamp
+);
+
+CREATE TABLE login_events (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    email text NOT NULL,
+    user_id uuid REFERENCES users (id) ON DELETE SET NULL,
+    ip text NOT NULL,
+    event text NOT NULL
+);
+
+CREATE INDEX login_events_email_created_at_idx ON login_events (email, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_events;
+DROP TABLE IF EXISTS login_throttles;
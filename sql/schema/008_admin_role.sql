@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE users ADD is_admin boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN is_admin;
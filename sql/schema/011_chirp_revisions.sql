@@ -0,0 +1,14 @@
+-- +goose Up
+-- Each row is a body a chirp had before an edit: created_at is when that
+-- body was written and replaced_at when the edit replaced it.
+CREATE TABLE chirp_revisions (
+    id uuid PRIMARY KEY,
+    chirp_id uuid NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at timestamp NOT NULL,
+    replaced_at timestamp NOT NULL
+);
+CREATE INDEX chirp_revisions_chirp_id_created_at_idx ON chirp_revisions (chirp_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS chirp_revisions;
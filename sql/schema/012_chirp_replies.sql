@@ -0,0 +1,36 @@
+-- +goose Up
+-- parent_id is the chirp a reply answers. It becomes NULL when that chirp is
+-- deleted, while is_reply keeps recording that the chirp was a reply.
+-- reply_count counts the direct replies and is kept current by a trigger, so
+-- that cascading deletes keep it right too.
+ALTER TABLE chirps
+ADD COLUMN parent_id uuid REFERENCES chirps (id) ON DELETE SET NULL,
+ADD COLUMN is_reply boolean NOT NULL DEFAULT false,
+ADD COLUMN reply_count integer NOT NULL DEFAULT 0;
+CREATE INDEX chirps_parent_id_created_at_id_idx ON chirps (parent_id, created_at, id);
+
+-- +goose StatementBegin
+CREATE FUNCTION chirps_count_replies() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE chirps SET reply_count = reply_count + 1 WHERE id = NEW.parent_id;
+    ELSE
+        UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirps_count_replies
+AFTER INSERT OR DELETE ON chirps
+FOR EACH ROW EXECUTE FUNCTION chirps_count_replies();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS chirps_count_replies ON chirps;
+DROP FUNCTION IF EXISTS chirps_count_replies();
+DROP INDEX IF EXISTS chirps_parent_id_created_at_id_idx;
+ALTER TABLE chirps
+DROP COLUMN reply_count,
+DROP COLUMN is_reply,
+DROP COLUMN parent_id;
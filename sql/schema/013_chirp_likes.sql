@@ -0,0 +1,36 @@
+-- +goose Up
+CREATE TABLE chirp_likes (
+    chirp_id uuid NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY (chirp_id, user_id)
+);
+CREATE INDEX chirp_likes_user_id_created_at_idx ON chirp_likes (user_id, created_at, chirp_id);
+
+-- like_count is kept current by a trigger like reply_count.
+ALTER TABLE chirps
+ADD COLUMN like_count integer NOT NULL DEFAULT 0;
+
+-- +goose StatementBegin
+CREATE FUNCTION chirp_likes_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE chirps SET like_count = like_count + 1 WHERE id = NEW.chirp_id;
+    ELSE
+        UPDATE chirps SET like_count = like_count - 1 WHERE id = OLD.chirp_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirp_likes_count
+AFTER INSERT OR DELETE ON chirp_likes
+FOR EACH ROW EXECUTE FUNCTION chirp_likes_count();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS chirp_likes_count ON chirp_likes;
+DROP FUNCTION IF EXISTS chirp_likes_count();
+ALTER TABLE chirps
+DROP COLUMN like_count;
+DROP TABLE IF EXISTS chirp_likes;
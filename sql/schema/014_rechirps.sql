@@ -0,0 +1,47 @@
+-- +goose Up
+-- A rechirp shares another chirp as is: it has no body of its own and goes
+-- away with the chirp it shares. A quote adds a body; when the quoted chirp
+-- is deleted, quote_of becomes NULL and is_quote keeps recording that the
+-- chirp was a quote. rechirp_count and quote_count are kept current by a
+-- trigger like reply_count.
+ALTER TABLE chirps
+ADD COLUMN rechirp_of uuid REFERENCES chirps (id) ON DELETE CASCADE,
+ADD COLUMN quote_of uuid REFERENCES chirps (id) ON DELETE SET NULL,
+ADD COLUMN is_quote boolean NOT NULL DEFAULT false,
+ADD COLUMN rechirp_count integer NOT NULL DEFAULT 0,
+ADD COLUMN quote_count integer NOT NULL DEFAULT 0,
+ADD CONSTRAINT chirps_rechirp_check CHECK (rechirp_of IS NULL OR (body = '' AND quote_of IS NULL AND parent_id IS NULL));
+CREATE UNIQUE INDEX chirps_user_id_rechirp_of_idx ON chirps (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL;
+CREATE INDEX chirps_quote_of_idx ON chirps (quote_of) WHERE quote_of IS NOT NULL;
+
+-- +goose StatementBegin
+CREATE FUNCTION chirps_count_rechirps() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE chirps SET rechirp_count = rechirp_count + 1 WHERE id = NEW.rechirp_of;
+        UPDATE chirps SET quote_count = quote_count + 1 WHERE id = NEW.quote_of;
+    ELSE
+        UPDATE chirps SET rechirp_count = rechirp_count - 1 WHERE id = OLD.rechirp_of;
+        UPDATE chirps SET quote_count = quote_count - 1 WHERE id = OLD.quote_of;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirps_count_rechirps
+AFTER INSERT OR DELETE ON chirps
+FOR EACH ROW EXECUTE FUNCTION chirps_count_rechirps();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS chirps_count_rechirps ON chirps;
+DROP FUNCTION IF EXISTS chirps_count_rechirps();
+DROP INDEX IF EXISTS chirps_quote_of_idx;
+DROP INDEX IF EXISTS chirps_user_id_rechirp_of_idx;
+ALTER TABLE chirps
+DROP CONSTRAINT chirps_rechirp_check,
+DROP COLUMN quote_count,
+DROP COLUMN rechirp_count,
+DROP COLUMN is_quote,
+DROP COLUMN quote_of,
+DROP COLUMN rechirp_of;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE tags (
+    id uuid PRIMARY KEY,
+    name text NOT NULL UNIQUE,
+    created_at timestamp NOT NULL
+);
+
+-- created_at is the time of the chirp, so that tag timelines and trending
+-- tags need not join chirps to order and filter by it.
+CREATE TABLE chirp_tags (
+    chirp_id uuid NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+    tag_id uuid NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY (chirp_id, tag_id)
+);
+CREATE INDEX chirp_tags_tag_id_created_at_idx ON chirp_tags (tag_id, created_at, chirp_id);
+CREATE INDEX chirp_tags_created_at_idx ON chirp_tags (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS chirp_tags;
+DROP TABLE IF EXISTS tags;
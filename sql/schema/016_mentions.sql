@@ -0,0 +1,23 @@
+-- +goose Up
+-- Handles are unique regardless of case but shown as their owner chose.
+ALTER TABLE users
+ADD COLUMN handle text;
+CREATE UNIQUE INDEX users_handle_key ON users (lower(handle));
+
+-- handle is the user's handle when the chirp mentioned them, which is what
+-- the body says even if they have changed it since. created_at is the time
+-- of the chirp, like in chirp_tags.
+CREATE TABLE chirp_mentions (
+    chirp_id uuid NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    handle text NOT NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY (chirp_id, user_id)
+);
+CREATE INDEX chirp_mentions_user_id_created_at_idx ON chirp_mentions (user_id, created_at, chirp_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS chirp_mentions;
+DROP INDEX IF EXISTS users_handle_key;
+ALTER TABLE users
+DROP COLUMN handle;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Profile fields are empty rather than null until their owner fills them in.
+ALTER TABLE users
+ADD COLUMN display_name text NOT NULL DEFAULT '',
+ADD COLUMN bio text NOT NULL DEFAULT '',
+ADD COLUMN website text NOT NULL DEFAULT '',
+ADD COLUMN avatar_url text NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN display_name,
+DROP COLUMN bio,
+DROP COLUMN website,
+DROP COLUMN avatar_url;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Index the search vector instead of storing it, so that only search queries
+-- compute it and every other chirp query stops reading it.
+ALTER TABLE chirps DROP COLUMN search;
+CREATE INDEX chirps_search_idx ON chirps USING GIN (to_tsvector('english', body));
+
+-- +goose Down
+DROP INDEX IF EXISTS chirps_search_idx;
+ALTER TABLE chirps
+ADD COLUMN search tsvector GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+CREATE INDEX chirps_search_idx ON chirps USING GIN (search);
@@ -0,0 +1,14 @@
+package main
+
+import "context"
+
+// startWorker runs fn in its own goroutine and tracks it so that shutdown can
+// wait for it to return. The context passed to fn is cancelled once the HTTP
+// server has finished draining; workers must return promptly after that.
+func (cfg *apiConfig) startWorker(fn func(ctx context.Context)) {
+	cfg.workers.Add(1)
+	go func() {
+		defer cfg.workers.Done()
+		fn(cfg.workerCtx)
+	}()
+}